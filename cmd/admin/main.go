@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"text/tabwriter"
+	"time"
 	"tritontube/internal/proto"
+	"tritontube/internal/ring"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func main() {
@@ -17,7 +23,16 @@ func main() {
 	}
 
 	cmd := os.Args[1]
-	serverAddr := os.Args[2]
+	args := os.Args[2:]
+	if cmd == "plan" {
+		// plan add|remove <server_address> <node_address>
+		cmd = "plan " + os.Args[2]
+		args = os.Args[3:]
+		if len(args) < 1 {
+			printUsageAndExit()
+		}
+	}
+	serverAddr := args[0]
 
 	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -29,19 +44,52 @@ func main() {
 
 	switch cmd {
 	case "add":
-		if len(os.Args) != 4 {
-			fmt.Println("Usage: add <server_address> <node_address>")
+		if len(args) < 2 {
+			fmt.Println("Usage: add <server_address> <node_address> [migration options]")
 			os.Exit(1)
 		}
-		addNode(client, os.Args[3])
+		options, jsonOutput := parseMigrationOptions("add", args[2:])
+		addNode(client, args[1], options, jsonOutput)
 	case "remove":
-		if len(os.Args) != 4 {
-			fmt.Println("Usage: remove <server_address> <node_address>")
+		if len(args) < 2 {
+			fmt.Println("Usage: remove <server_address> <node_address> [migration options]")
+			os.Exit(1)
+		}
+		options, jsonOutput := parseMigrationOptions("remove", args[2:])
+		removeNode(client, args[1], options, jsonOutput)
+	case "drain":
+		if len(args) < 2 {
+			fmt.Println("Usage: drain <server_address> <node_address> [migration options]")
+			os.Exit(1)
+		}
+		fs := flag.NewFlagSet("drain", flag.ExitOnError)
+		options := migrationFlags(fs)
+		parseFlags(fs, args[2:])
+		drainNode(client, args[1], options())
+	case "plan add", "plan remove":
+		if len(args) < 2 {
+			fmt.Printf("Usage: %s <server_address> <node_address> [-files]\n", cmd)
+			os.Exit(1)
+		}
+		planMigration(client, cmd == "plan add", args[1], args[2:])
+	case "repair":
+		if len(args) < 1 {
+			fmt.Println("Usage: repair <server_address> [-dry-run] [migration options]")
 			os.Exit(1)
 		}
-		removeNode(client, os.Args[3])
+		fs := flag.NewFlagSet("repair", flag.ExitOnError)
+		options := migrationFlags(fs)
+		dryRun := fs.Bool("dry-run", false, "only show what would be done")
+		parseFlags(fs, args[1:])
+		repairCluster(client, options(), *dryRun)
+	case "stats":
+		if len(args) < 1 {
+			fmt.Println("Usage: stats <server_address> [-videos]")
+			os.Exit(1)
+		}
+		clusterStats(client, args[1:])
 	case "list":
-		if len(os.Args) != 3 {
+		if len(args) != 1 {
 			fmt.Println("Usage: list <server_address>")
 			os.Exit(1)
 		}
@@ -54,38 +102,377 @@ func main() {
 
 func printUsageAndExit() {
 	fmt.Println("Usage:")
-	fmt.Println("  add <server_address> <node_address>     - Add a node to the cluster")
-	fmt.Println("  remove <server_address> <node_address>  - Remove a node from the cluster")
-	fmt.Println("  list <server_address>                   - List all nodes in the cluster")
+	fmt.Println("  add <server_address> <node_address>         - Add a node to the cluster")
+	fmt.Println("  remove <server_address> <node_address>      - Remove a node from the cluster")
+	fmt.Println("  drain <server_address> <node_address>       - Move a node's data off in the background, then remove it")
+	fmt.Println("  list <server_address>                       - List all nodes in the cluster")
+	fmt.Println("  stats <server_address> [-videos]            - Show how data is spread across the nodes")
+	fmt.Println("  repair <server_address> [-dry-run]          - Move misplaced files to their owners, delete duplicates")
+	fmt.Println("  plan add <server_address> <node_address>    - Show what adding a node would move")
+	fmt.Println("  plan remove <server_address> <node_address> - Show what removing a node would move")
+	fmt.Println()
+	fmt.Println("Migration options (add, remove, drain, repair):")
+	fmt.Println("  -concurrency N          files copied in parallel")
+	fmt.Println("  -bytes-per-second N     limit on migrated bytes per second")
+	fmt.Println("  -rpc-timeout D          deadline for each storage RPC (e.g. 30s)")
+	fmt.Println("  -retries N              retries for each failed storage RPC, 0 for none")
+	fmt.Println("  -retry-backoff D        wait before the first retry, doubled after each one")
+	fmt.Println("  -json                   print progress as one JSON object per line (add, remove)")
+	fmt.Println("Unset options use the coordinator's defaults.")
 	os.Exit(1)
 }
 
-func addNode(client proto.VideoContentAdminServiceClient, nodeAddr string) {
+func parseMigrationOptions(cmd string, args []string) (*proto.MigrationOptions, bool) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	options := migrationFlags(fs)
+	jsonOutput := fs.Bool("json", false, "print progress as one JSON object per line")
+	parseFlags(fs, args)
+	return options(), *jsonOutput
+}
+
+// migrationFlags registers the migration tuning flags on fs and returns a
+// function building the options once fs has been parsed.
+func migrationFlags(fs *flag.FlagSet) func() *proto.MigrationOptions {
+	concurrency := fs.Int("concurrency", 0, "files copied in parallel")
+	bytesPerSecond := fs.Int64("bytes-per-second", 0, "limit on migrated bytes per second")
+	rpcTimeout := fs.Duration("rpc-timeout", 0, "deadline for each storage RPC")
+	retries := fs.Int("retries", 0, "retries for each failed storage RPC")
+	retryBackoff := fs.Duration("retry-backoff", 0, "wait before the first retry, doubled after each one")
+	return func() *proto.MigrationOptions {
+		options := &proto.MigrationOptions{
+			Concurrency:    int32(*concurrency),
+			BytesPerSecond: *bytesPerSecond,
+			RpcTimeoutMs:   rpcTimeout.Milliseconds(),
+		}
+		// 0 is a valid number of retries and backoff, so send them only if given
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "retries":
+				n := int32(*retries)
+				options.MaxRetries = &n
+			case "retry-backoff":
+				ms := retryBackoff.Milliseconds()
+				options.RetryBackoffMs = &ms
+			}
+		})
+		return options
+	}
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Printf("Unexpected argument: %s\n", fs.Arg(0))
+		printUsageAndExit()
+	}
+}
+
+func addNode(client proto.VideoContentAdminServiceClient, nodeAddr string, options *proto.MigrationOptions, jsonOutput bool) {
 	ctx := context.Background()
 
-	response, err := client.AddNode(ctx, &proto.AddNodeRequest{
+	stream, err := client.AddNodeStream(ctx, &proto.AddNodeRequest{
 		NodeAddress: nodeAddr,
+		Options:     options,
 	})
 	if err != nil {
 		log.Fatalf("AddNode RPC failed: %v", err)
 	}
+	result := followMigration(stream, jsonOutput)
 
-	fmt.Printf("Successfully added node: %s\n", nodeAddr)
-	fmt.Printf("Number of files migrated: %d\n", response.MigratedFileCount)
+	if !result.Completed {
+		if !jsonOutput {
+			printIncomplete("Adding", nodeAddr, result)
+		}
+		os.Exit(1)
+	}
+	if !jsonOutput {
+		fmt.Printf("Successfully added node: %s\n", nodeAddr)
+		fmt.Printf("Number of files migrated: %d\n", result.MigratedFileCount)
+	}
 }
 
-func removeNode(client proto.VideoContentAdminServiceClient, nodeAddr string) {
+func removeNode(client proto.VideoContentAdminServiceClient, nodeAddr string, options *proto.MigrationOptions, jsonOutput bool) {
 	ctx := context.Background()
 
-	response, err := client.RemoveNode(ctx, &proto.RemoveNodeRequest{
+	stream, err := client.RemoveNodeStream(ctx, &proto.RemoveNodeRequest{
 		NodeAddress: nodeAddr,
+		Options:     options,
 	})
 	if err != nil {
 		log.Fatalf("RemoveNode RPC failed: %v", err)
 	}
+	result := followMigration(stream, jsonOutput)
+
+	if !result.Completed {
+		if !jsonOutput {
+			printIncomplete("Removing", nodeAddr, result)
+		}
+		os.Exit(1)
+	}
+	if !jsonOutput {
+		fmt.Printf("Successfully removed node: %s\n", nodeAddr)
+		fmt.Printf("Number of files migrated: %d\n", result.MigratedFileCount)
+	}
+}
+
+func drainNode(client proto.VideoContentAdminServiceClient, nodeAddr string, options *proto.MigrationOptions) {
+	ctx := context.Background()
+
+	_, err := client.DrainNode(ctx, &proto.DrainNodeRequest{
+		NodeAddress: nodeAddr,
+		Options:     options,
+	})
+	if err != nil {
+		log.Fatalf("DrainNode RPC failed: %v", err)
+	}
+	fmt.Printf("Draining node: %s\n", nodeAddr)
+	fmt.Println("It is removed from the ring once its data has moved; follow it with the list command.")
+}
+
+// printIncomplete explains a migration that stopped with failures.
+func printIncomplete(verb string, nodeAddr string, result *proto.MigrationProgress) {
+	if result.Stage == "deleting" {
+		fmt.Printf("%s node %s is incomplete: %d files could not be deleted from their old node\n", verb, nodeAddr, result.FilesFailed)
+		fmt.Println("The ring was changed. Re-run the command to delete the leftover copies.")
+		return
+	}
+	fmt.Printf("%s node %s is incomplete: %d files failed to migrate\n", verb, nodeAddr, result.FilesFailed)
+	fmt.Println("The ring was not changed. Re-run the command to resume the migration.")
+}
+
+// followMigration renders the progress of a streaming migration until it
+// finishes and returns the final message. With jsonOutput every message is
+// printed as one JSON object per line instead.
+func followMigration(stream grpc.ServerStreamingClient[proto.MigrationProgress], jsonOutput bool) *proto.MigrationProgress {
+	marshaler := protojson.MarshalOptions{EmitUnpopulated: true}
+	var last *proto.MigrationProgress
+	for {
+		progress, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !jsonOutput {
+				fmt.Println()
+			}
+			log.Fatalf("Migration failed: %v", err)
+		}
+		last = progress
+
+		if jsonOutput {
+			out, err := marshaler.Marshal(progress)
+			if err != nil {
+				log.Fatalf("Failed to encode progress: %v", err)
+			}
+			fmt.Println(string(out))
+			continue
+		}
+		for _, e := range progress.Errors {
+			fmt.Printf("\r\033[K  failed %s: %s\n", e.File, e.Error)
+		}
+		fmt.Printf("\r\033[K[%s] %d/%d files, %s moved, %s/s, ETA %s, %d failed",
+			progress.Stage, progress.FilesDone, progress.FilesTotal,
+			formatBytes(progress.BytesMoved), formatBytes(int64(progress.BytesPerSecond)),
+			(time.Duration(progress.EtaMs) * time.Millisecond).Round(time.Second), progress.FilesFailed)
+		if progress.Finished {
+			fmt.Println()
+		}
+	}
+	if last == nil || !last.Finished {
+		log.Fatalf("Migration stream ended without a result")
+	}
+	return last
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatCapacity(n int64) string {
+	if n <= 0 {
+		return "unknown"
+	}
+	return formatBytes(n)
+}
+
+func planMigration(client proto.VideoContentAdminServiceClient, add bool, nodeAddr string, args []string) {
+	ctx := context.Background()
+
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	listFiles := fs.Bool("files", false, "list every file that would move")
+	fs.Parse(args)
+
+	var plan *proto.MigrationPlan
+	var err error
+	if add {
+		plan, err = client.PlanAddNode(ctx, &proto.AddNodeRequest{NodeAddress: nodeAddr})
+	} else {
+		plan, err = client.PlanRemoveNode(ctx, &proto.RemoveNodeRequest{NodeAddress: nodeAddr})
+	}
+	if err != nil {
+		log.Fatalf("Plan RPC failed: %v", err)
+	}
+
+	if add {
+		fmt.Printf("Adding node %s would move:\n", nodeAddr)
+	} else {
+		fmt.Printf("Removing node %s would move:\n", nodeAddr)
+	}
+	if len(plan.Moves) == 0 {
+		fmt.Println("  Nothing")
+		return
+	}
+	for _, move := range plan.Moves {
+		fmt.Printf("  %s -> %s: %d files, %s\n", move.Src, move.Dst, len(move.Files), formatBytes(move.Bytes))
+		if *listFiles {
+			for _, file := range move.Files {
+				fmt.Printf("    %s\n", file)
+			}
+		}
+	}
+	fmt.Printf("Total: %d files, %s\n", plan.TotalFiles, formatBytes(plan.TotalBytes))
+}
+
+func repairCluster(client proto.VideoContentAdminServiceClient, options *proto.MigrationOptions, dryRun bool) {
+	ctx := context.Background()
+
+	response, err := client.Repair(ctx, &proto.RepairRequest{DryRun: dryRun, Options: options})
+	if err != nil {
+		log.Fatalf("Repair RPC failed: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, action := range response.Actions {
+		counts[action.Action]++
+		switch action.Action {
+		case "move", "restore":
+			fmt.Printf("  %-8s %s %s -> %s", action.Action, action.File, action.Node, action.Owner)
+		default:
+			fmt.Printf("  %-8s %s on %s", action.Action, action.File, action.Node)
+		}
+		if action.Detail != "" {
+			fmt.Printf(" (%s)", action.Detail)
+		}
+		fmt.Println()
+	}
+	for _, e := range response.Errors {
+		fmt.Printf("  failed   %s: %s\n", e.File, e.Error)
+	}
+	if dryRun {
+		fmt.Print("Dry run, nothing was changed. Would have: ")
+	} else {
+		fmt.Print("Repair finished: ")
+	}
+	fmt.Printf("checked %d files, %d moved, %d restored, %d copies deleted, %d conflicts, %d failed\n",
+		response.FilesChecked, counts["move"], counts["restore"], counts["delete"], counts["conflict"], len(response.Errors))
+	if len(response.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// clusterStats asks every ring member for its stats and compares the share
+// of bytes each one holds with the share of the hash space it owns.
+func clusterStats(client proto.VideoContentAdminServiceClient, args []string) {
+	ctx := context.Background()
+
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	showVideos := fs.Bool("videos", false, "show the bytes each node holds per video")
+	parseFlags(fs, args)
+
+	response, err := client.ListNodes(ctx, &proto.ListNodesRequest{})
+	if err != nil {
+		log.Fatalf("ListNodes RPC failed: %v", err)
+	}
+	if len(response.Nodes) == 0 {
+		fmt.Println("No nodes in cluster")
+		return
+	}
+	shares := ring.New(0, response.Nodes).Shares()
 
-	fmt.Printf("Successfully removed node: %s\n", nodeAddr)
-	fmt.Printf("Number of files migrated: %d\n", response.MigratedFileCount)
+	stats := make(map[string]*proto.StatsResponse)
+	var totalBytes int64
+	for _, addr := range response.Nodes {
+		nodeStats, err := nodeStats(ctx, addr)
+		if err != nil {
+			fmt.Printf("Failed to get stats from %s: %v\n", addr, err)
+			continue
+		}
+		stats[addr] = nodeStats
+		totalBytes += nodeStats.TotalBytes
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "NODE\tFILES\tBYTES\tDATA SHARE\tRING SHARE\tBALANCE\tFREE\tUPTIME\t")
+	for _, addr := range response.Nodes {
+		nodeStats, ok := stats[addr]
+		if !ok {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t%.1f%%\t-\t-\t-\t\n", addr, shares[addr]*100)
+			continue
+		}
+		dataShare := 0.0
+		if totalBytes > 0 {
+			dataShare = float64(nodeStats.TotalBytes) / float64(totalBytes)
+		}
+		// 1.00x means the node holds exactly its share of the hash space
+		balance := "-"
+		if totalBytes > 0 && shares[addr] > 0 {
+			balance = fmt.Sprintf("%.2fx", dataShare/shares[addr])
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.1f%%\t%.1f%%\t%s\t%s\t%v\t\n", addr, nodeStats.FileCount,
+			formatBytes(nodeStats.TotalBytes), dataShare*100, shares[addr]*100, balance,
+			formatCapacity(nodeStats.FreeBytes), (time.Duration(nodeStats.UptimeMs) * time.Millisecond).Round(time.Second))
+	}
+	w.Flush()
+	fmt.Printf("Total: %s on %d nodes\n", formatBytes(totalBytes), len(response.Nodes))
+	for _, addr := range response.Nodes {
+		nodeStats, ok := stats[addr]
+		if !ok || len(nodeStats.CorruptFiles) == 0 {
+			continue
+		}
+		scrubbed := time.Since(time.UnixMilli(nodeStats.LastScrubUnixMs)).Round(time.Second)
+		fmt.Printf("%s: %d corrupt files found by the scrub %v ago:\n", addr, len(nodeStats.CorruptFiles), scrubbed)
+		for _, file := range nodeStats.CorruptFiles {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+
+	if !*showVideos {
+		return
+	}
+	for _, addr := range response.Nodes {
+		nodeStats, ok := stats[addr]
+		if !ok {
+			continue
+		}
+		fmt.Printf("\n%s:\n", addr)
+		if len(nodeStats.Videos) == 0 {
+			fmt.Println("  No videos")
+		}
+		for _, video := range nodeStats.Videos {
+			fmt.Printf("  %s: %d files, %s\n", video.VideoId, video.FileCount, formatBytes(video.Bytes))
+		}
+	}
+}
+
+// nodeStats calls Stats on the storage node at addr directly.
+func nodeStats(ctx context.Context, addr string) (*proto.StatsResponse, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return proto.NewStorageServiceClient(conn).Stats(ctx, &proto.StatsRequest{})
 }
 
 func listNodes(client proto.VideoContentAdminServiceClient) {
@@ -100,8 +487,19 @@ func listNodes(client proto.VideoContentAdminServiceClient) {
 	if len(response.Nodes) == 0 {
 		fmt.Println("  No nodes in cluster")
 	} else {
-		for _, node := range response.Nodes {
-			fmt.Printf("  - %s\n", node)
+		for _, status := range response.Statuses {
+			fmt.Printf("  - %s [%s, %s]", status.Address, status.State, status.Health)
+			if status.Detail != "" {
+				fmt.Printf(" %s", status.Detail)
+			}
+			if status.HealthDetail != "" {
+				fmt.Printf(" (%s)", status.HealthDetail)
+			}
+			if status.Registered {
+				fmt.Printf(" registered, capacity %s, last heartbeat %v ago", formatCapacity(status.CapacityBytes),
+					(time.Duration(status.LastHeartbeatMsAgo) * time.Millisecond).Round(time.Second))
+			}
+			fmt.Println()
 		}
 	}
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"tritontube/internal/coordinator"
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
+
+	pb "tritontube/internal/proto"
+
+	"google.golang.org/grpc"
+)
+
+func main() {
+	host := flag.String("host", "localhost", "Host address for the coordinator")
+	port := flag.Int("port", 8081, "Port number for the coordinator")
+	journalPath := flag.String("journal", "coordinator.journal", "Path of the migration journal used to resume interrupted migrations")
+	heartbeatGrace := flag.Duration("heartbeat-grace", 10*time.Second, "How long a registered storage node may miss heartbeats before its data is reassigned")
+	repairInterval := flag.Duration("repair-interval", 0, "How often to run an anti-entropy repair of file placement, 0 to only repair on request")
+	metricsPort := flag.Int("metrics-port", 0, "Port to serve Prometheus metrics on at /metrics, 0 to disable")
+	logLevel := flag.String("log-level", "info", "Lowest level to log: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	flag.Parse()
+
+	// Validate arguments
+	if *port <= 0 {
+		panic("Error: Port number must be positive")
+	}
+	if *heartbeatGrace <= 0 {
+		panic("Error: Heartbeat grace must be positive")
+	}
+
+	if flag.NArg() > 1 {
+		fmt.Println("Usage: coordinator [OPTIONS] [storage_address,...]")
+		fmt.Println("Error: storage addresses must be a single comma-separated argument")
+		return
+	}
+	var storageAddrs []string
+	if flag.NArg() == 1 && flag.Arg(0) != "" {
+		storageAddrs = strings.Split(flag.Arg(0), ",")
+	}
+
+	if err := logging.Setup(*logLevel, *logFormat); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	slog.Info("Starting coordinator",
+		"host", *host,
+		"port", *port,
+		"storage_nodes", storageAddrs,
+		"journal", *journalPath,
+		"heartbeat_grace", *heartbeatGrace,
+		"repair_interval", *repairInterval)
+
+	// go run ./cmd/coordinator -port 8081 "localhost:8090,localhost:8091"
+
+	coordAddr := fmt.Sprintf("%s:%d", *host, *port)
+	coord, err := coordinator.NewCoordinator(storageAddrs, *journalPath, *heartbeatGrace)
+	if err != nil {
+		slog.Error("Unable to create coordinator", "error", err)
+		os.Exit(1)
+	}
+	defer coord.Close()
+	if *repairInterval > 0 {
+		coord.StartRepairSchedule(*repairInterval)
+	}
+	grpcServer := grpc.NewServer(append(logging.ServerOptions(), metrics.ServerOptions()...)...)
+	pb.RegisterVideoContentAdminServiceServer(grpcServer, coord)
+
+	go func() {
+		lis, err := net.Listen("tcp", coordAddr)
+		if err != nil {
+			slog.Error("Failed to listen", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("gRPC server listening", "addr", coordAddr)
+		if err := grpcServer.Serve(lis); err != nil {
+			slog.Error("Failed to serve", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	if *metricsPort > 0 {
+		metrics.Serve(fmt.Sprintf("%s:%d", *host, *metricsPort))
+	}
+
+	// Wait for ctrl+c to terminate gracefully
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	slog.Info("Shutting down gRPC server")
+	grpcServer.Stop()
+}
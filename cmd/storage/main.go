@@ -1,23 +1,39 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
 	"tritontube/internal/storage"
 
 	"net"
 	pb "tritontube/internal/proto"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 )
 
 func main() {
 	host := flag.String("host", "localhost", "Host address for the server")
 	port := flag.Int("port", 8090, "Port number for the server")
+	coordinatorAddr := flag.String("coordinator", "", "Coordinator address to register with; the node joins the ring by itself and sends heartbeats")
+	advertiseAddr := flag.String("advertise", "", "Address the coordinator and web servers use to reach this node (default host:port)")
+	capacity := flag.Int64("capacity", 0, "Storage capacity in bytes reported to the coordinator, 0 if unknown")
+	scrubInterval := flag.Duration("scrub-interval", time.Hour, "How often to re-hash every stored file against its checksum, 0 to disable")
+	backendName := flag.String("backend", storage.BackendFS, "How files are kept on disk: fs (one file each) or pack (appended to pack files)")
+	compactInterval := flag.Duration("compact-interval", time.Minute, "How often the pack backend checks whether to compact, 0 to disable")
+	metricsPort := flag.Int("metrics-port", 0, "Port to serve Prometheus metrics on at /metrics, 0 to disable")
+	logLevel := flag.String("log-level", "info", "Lowest level to log: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
 	flag.Parse()
 
 	// Validate arguments
@@ -31,38 +47,97 @@ func main() {
 		return
 	}
 	baseDir := flag.Arg(0)
+	if err := logging.Setup(*logLevel, *logFormat); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
-	fmt.Println("Starting storage server...")
-	fmt.Printf("Host: %s\n", *host)
-	fmt.Printf("Port: %d\n", *port)
-	fmt.Printf("Base Directory: %s\n", baseDir)
+	slog.Info("Starting storage server", "host", *host, "port", *port, "dir", baseDir, "backend", *backendName)
 
 	// go run ./cmd/storage -host localhost -port 8090 "./storage/8090"
 
 	nodeAddr := fmt.Sprintf("%s:%d", *host, *port)
-	storageserver, err := storage.NewStorageService(baseDir)
-	if err != nil {
-		panic("Unable to create storage")
+	if *advertiseAddr == "" {
+		*advertiseAddr = nodeAddr
 	}
-	grpcServer := grpc.NewServer()
+	if *coordinatorAddr != "" {
+		slog.Info("Registering with coordinator", "coordinator", *coordinatorAddr, "advertise", *advertiseAddr)
+	}
+	var backend storage.Backend
+	switch *backendName {
+	case storage.BackendFS:
+		fsBackend, err := storage.NewFSBackend(baseDir)
+		if err != nil {
+			slog.Error("Unable to create storage", "error", err)
+			os.Exit(1)
+		}
+		backend = fsBackend
+	case storage.BackendPack:
+		packBackend, err := storage.OpenPackBackend(baseDir)
+		if err != nil {
+			slog.Error("Unable to open pack storage", "error", err)
+			os.Exit(1)
+		}
+		if *compactInterval > 0 {
+			packBackend.StartCompaction(*compactInterval)
+		}
+		backend = packBackend
+	default:
+		fmt.Printf("Error: unknown backend %q, expected fs or pack\n", *backendName)
+		return
+	}
+	defer backend.Close()
+	storageserver := storage.NewStorageService(baseDir, backend)
+	if *scrubInterval > 0 {
+		storageserver.StartScrubber(*scrubInterval)
+	}
+	// allow the keepalive pings web servers send on idle connections
+	serverOptions := append(logging.ServerOptions(), metrics.ServerOptions()...)
+	serverOptions = append(serverOptions, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             5 * time.Second,
+		PermitWithoutStream: true,
+	}))
+	grpcServer := grpc.NewServer(serverOptions...)
 	pb.RegisterStorageServiceServer(grpcServer, storageserver)
+	// standard gRPC health service, probed by the coordinator and web servers
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(pb.StorageService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
 
 	go func() {
 		lis, err := net.Listen("tcp", nodeAddr)
 		if err != nil {
-			log.Fatalf("Failed to listen: %v", err)
+			slog.Error("Failed to listen", "error", err)
+			os.Exit(1)
 		}
-		log.Printf("gRPC server listening on %s", nodeAddr)
+		slog.Info("gRPC server listening", "addr", nodeAddr)
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("Failed to serve: %v", err)
+			slog.Error("Failed to serve", "error", err)
+			os.Exit(1)
 		}
 	}()
 
+	if *metricsPort > 0 {
+		metrics.Serve(fmt.Sprintf("%s:%d", *host, *metricsPort))
+	}
+
+	ctx, stopHeartbeats := context.WithCancel(context.Background())
+	if *coordinatorAddr != "" {
+		go func() {
+			if err := storage.RunHeartbeats(ctx, *coordinatorAddr, *advertiseAddr, *capacity); err != nil {
+				slog.Error("Failed to register with coordinator", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Wait for ctrl+c to terminate gracefully
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
-	log.Println("Shutting down gRPC server...")
+	stopHeartbeats()
+	slog.Info("Shutting down gRPC server")
+	healthServer.Shutdown()
 	grpcServer.GracefulStop()
 
 }
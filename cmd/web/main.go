@@ -3,7 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log/slog"
 	"net"
+	"tritontube/internal/logging"
 	"tritontube/internal/web"
 )
 
@@ -15,7 +17,7 @@ func printUsage() {
 	fmt.Println("  METADATA_TYPE         Metadata service type (sqlite, etcd)")
 	fmt.Println("  METADATA_OPTIONS      Options for metadata service (e.g., db path)")
 	fmt.Println("  CONTENT_TYPE          Content service type (fs, nw)")
-	fmt.Println("  CONTENT_OPTIONS       Options for content service (e.g., base dir, network addresses)")
+	fmt.Println("  CONTENT_OPTIONS       Options for content service (e.g., base dir, coordinator address)")
 	fmt.Println()
 	fmt.Println("Options:")
 	flag.PrintDefaults()
@@ -27,6 +29,24 @@ func main() {
 	// Define flags
 	port := flag.Int("port", 8080, "Port number for the web server")
 	host := flag.String("host", "localhost", "Host address for the web server")
+	rpcOptions := web.DefaultRPCOptions
+	flag.DurationVar(&rpcOptions.ReadTimeout, "storage-read-timeout", rpcOptions.ReadTimeout, "Deadline of each storage read attempt (nw content only)")
+	flag.DurationVar(&rpcOptions.WriteTimeout, "storage-write-timeout", rpcOptions.WriteTimeout, "Deadline of a storage write, per file for batch uploads (nw content only)")
+	flag.IntVar(&rpcOptions.Retries, "storage-retries", rpcOptions.Retries, "Retries of a storage read that failed transiently (nw content only)")
+	flag.DurationVar(&rpcOptions.RetryBackoff, "storage-retry-backoff", rpcOptions.RetryBackoff, "Wait before the first read retry, doubled after each one, with jitter (nw content only)")
+	flag.DurationVar(&rpcOptions.KeepaliveTime, "storage-keepalive", rpcOptions.KeepaliveTime, "Ping idle storage connections this often, 0 to disable (nw content only)")
+	flag.DurationVar(&rpcOptions.KeepaliveTimeout, "storage-keepalive-timeout", rpcOptions.KeepaliveTimeout, "Drop a storage connection whose ping is not answered within this (nw content only)")
+	flag.DurationVar(&rpcOptions.MaxReconnectBackoff, "storage-reconnect-backoff", rpcOptions.MaxReconnectBackoff, "Longest wait between attempts to reconnect to a storage node (nw content only)")
+	cacheOptions := web.DefaultCacheOptions
+	flag.Int64Var(&cacheOptions.MaxBytes, "cache-size", cacheOptions.MaxBytes, "Bytes of video files to cache in memory, 0 to disable the cache")
+	flag.StringVar(&cacheOptions.Dir, "cache-dir", "", "Directory to also cache video files in (default none)")
+	flag.Int64Var(&cacheOptions.DiskMaxBytes, "cache-disk-size", cacheOptions.DiskMaxBytes, "Bytes of video files to cache in -cache-dir")
+	flag.DurationVar(&cacheOptions.ManifestTTL, "cache-manifest-ttl", cacheOptions.ManifestTTL, "How long a cached manifest is served")
+	flag.DurationVar(&cacheOptions.SegmentTTL, "cache-segment-ttl", cacheOptions.SegmentTTL, "How long a cached segment is served")
+	flag.IntVar(&cacheOptions.PrefetchSegments, "prefetch-segments", cacheOptions.PrefetchSegments, "Segments to fetch into the cache ahead of the one a viewer asks for, 0 to disable")
+	flag.IntVar(&cacheOptions.PrefetchWorkers, "prefetch-workers", cacheOptions.PrefetchWorkers, "Most prefetches to run at once")
+	logLevel := flag.String("log-level", "info", "Lowest level to log: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
 
 	// Set custom usage message
 	flag.Usage = printUsage
@@ -53,16 +73,34 @@ func main() {
 		printUsage()
 		return
 	}
+	if rpcOptions.ReadTimeout <= 0 || rpcOptions.WriteTimeout <= 0 || rpcOptions.MaxReconnectBackoff <= 0 {
+		fmt.Println("Error: storage timeouts and reconnect backoff must be positive")
+		return
+	}
+	if cacheOptions.MaxBytes < 0 || cacheOptions.DiskMaxBytes < 0 || cacheOptions.ManifestTTL < 0 || cacheOptions.SegmentTTL < 0 ||
+		cacheOptions.PrefetchSegments < 0 || cacheOptions.PrefetchWorkers < 0 {
+		fmt.Println("Error: cache sizes, TTLs and prefetch settings must not be negative")
+		return
+	}
+	if rpcOptions.Retries < 0 || rpcOptions.RetryBackoff < 0 || rpcOptions.KeepaliveTime < 0 || rpcOptions.KeepaliveTimeout < 0 {
+		fmt.Println("Error: storage retries, backoff and keepalive must not be negative")
+		return
+	}
+
+	if err := logging.Setup(*logLevel, *logFormat); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
 	// Construct metadata service
 	var metadataService web.VideoMetadataService
-	fmt.Println("Creating metadata service of type", metadataServiceType, "with options", metadataServiceOptions)
+	slog.Info("Creating metadata service", "type", metadataServiceType, "options", metadataServiceOptions)
 	// TODO: Implement metadata service creation logic
 	if metadataServiceType == "sqlite" {
 		var err error
 		metadataService, err = web.NewSQLiteVideoMetadataService(metadataServiceOptions)
 		if err != nil {
-			fmt.Println("Error initializing SQLite metadata service:", err)
+			slog.Error("Error initializing SQLite metadata service", "error", err)
 			return
 		}
 	} else {
@@ -73,20 +111,20 @@ func main() {
 
 	// Construct content service
 	var contentService web.VideoContentService
-	fmt.Println("Creating content service of type", contentServiceType, "with options", contentServiceOptions)
+	slog.Info("Creating content service", "type", contentServiceType, "options", contentServiceOptions)
 	// TODO: Implement content service creation logic
 	if contentServiceType == "fs" {
 		var err error
 		contentService, err = web.NewFSVideoContentService(contentServiceOptions)
 		if err != nil {
-			fmt.Println("Error initializing FS content service:", err)
+			slog.Error("Error initializing FS content service", "error", err)
 			return
 		}
 	} else if contentServiceType == "nw" {
 		var err error
-		contentService, err = web.NewNetworkVideoContentService(contentServiceOptions)
+		contentService, err = web.NewNetworkVideoContentService(contentServiceOptions, rpcOptions)
 		if err != nil {
-			fmt.Println("Error initializing FS content service:", err)
+			slog.Error("Error initializing network content service", "error", err)
 			return
 		}
 
@@ -95,20 +133,28 @@ func main() {
 		printUsage()
 		return
 	}
+	if cacheOptions.MaxBytes > 0 {
+		var err error
+		contentService, err = web.NewCachedVideoContentService(contentService, cacheOptions)
+		if err != nil {
+			slog.Error("Error initializing content cache", "error", err)
+			return
+		}
+	}
 	// Start the server
 	server := web.NewServer(metadataService, contentService)
 	listenAddr := fmt.Sprintf("%s:%d", *host, *port)
 	lis, err := net.Listen("tcp", listenAddr)
 	if err != nil {
-		fmt.Println("Error starting listener:", err)
+		slog.Error("Error starting listener", "error", err)
 		return
 	}
 	defer lis.Close()
 
-	fmt.Println("Starting web server on", listenAddr)
+	slog.Info("Starting web server", "addr", listenAddr)
 	err = server.Start(lis)
 	if err != nil {
-		fmt.Println("Error starting server:", err)
+		slog.Error("Error starting server", "error", err)
 		return
 	}
 }
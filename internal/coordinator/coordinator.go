@@ -0,0 +1,527 @@
+// Cluster coordinator: owns ring membership and data migration
+
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+	"tritontube/internal/health"
+	"tritontube/internal/metrics"
+	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Coordinator implements VideoContentAdminService. It is the single owner of
+// the ring; web servers subscribe to it through WatchRing and route requests
+// using the membership it pushes.
+type Coordinator struct {
+	pb.UnimplementedVideoContentAdminServiceServer
+	aliveNodes []node // always sorted by hash
+	version    uint64
+	phase      pb.RingPhase
+	otherNodes []node // next ring while joining, previous ring while migrating
+	draining   map[string]*drainStatus
+	mu         sync.RWMutex
+
+	// adminMu serialises AddNode/RemoveNode so only one migration runs at a time
+	adminMu     sync.Mutex
+	journalPath string
+	pending     *journal // unfinished migration, guarded by adminMu
+
+	watchersMu sync.Mutex
+	watchers   map[*watcher]struct{}
+	// closed and replaced whenever a watcher acknowledges a ring or leaves
+	acked chan struct{}
+
+	health *health.Checker // probes every node in the published rings
+
+	// storage nodes that registered themselves, guarded by mu
+	members        map[string]*member
+	heartbeatGrace time.Duration
+	stopMonitor    chan struct{}
+}
+
+type node struct {
+	addr   string
+	hash   uint64
+	client pb.StorageServiceClient
+	conn   *grpc.ClientConn
+}
+
+// NewCoordinator builds a ring from addrs. If journalPath holds the journal of
+// an interrupted migration, it is resumed in the background. Registered nodes
+// that miss heartbeats for longer than heartbeatGrace are drained.
+func NewCoordinator(addrs []string, journalPath string, heartbeatGrace time.Duration) (*Coordinator, error) {
+	c := &Coordinator{
+		aliveNodes:     make([]node, 0),
+		draining:       make(map[string]*drainStatus),
+		journalPath:    journalPath,
+		watchers:       make(map[*watcher]struct{}),
+		acked:          make(chan struct{}),
+		health:         health.NewChecker(),
+		members:        make(map[string]*member),
+		heartbeatGrace: heartbeatGrace,
+		stopMonitor:    make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		newNode, err := dialNode(addr)
+		if err != nil {
+			slog.Error("Unable to add storage node", "node", addr, "error", err)
+			c.Close()
+			return nil, err
+		}
+		c.aliveNodes = insertNode(c.aliveNodes, newNode)
+	}
+	c.version = 1
+	c.health.Set(nodeAddrs(c.aliveNodes))
+
+	j, err := openJournal(journalPath)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if j != nil {
+		c.pending = j
+		c.adminMu.Lock()
+		go func() {
+			defer c.adminMu.Unlock()
+			slog.Info("Resuming interrupted migration", "op", j.m.Op, "node", j.m.Node)
+			summary, err := c.runMigration(j, defaultMigrationOptions, nil)
+			if err != nil {
+				slog.Error("Failed to resume migration", "op", j.m.Op, "node", j.m.Node, "error", err)
+				return
+			}
+			if summary.completed {
+				c.pending = nil
+			}
+			slog.Info("Resumed migration", "op", j.m.Op, "node", j.m.Node, "migrated", summary.migrated, "errors", len(summary.errors), "completed", summary.completed)
+		}()
+	}
+	go c.monitorMembers()
+	return c, nil
+}
+
+// Close releases the connections to every storage node.
+func (c *Coordinator) Close() {
+	close(c.stopMonitor)
+	c.health.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range c.aliveNodes {
+		n.conn.Close()
+	}
+	c.aliveNodes = nil
+}
+
+func (c *Coordinator) ListNodes(ctx context.Context, rr *pb.ListNodesRequest) (*pb.ListNodesResponse, error) {
+	//assumes a sorted list
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	respList := make([]string, 0)
+	statuses := make([]*pb.NodeStatus, 0)
+	for _, node := range c.aliveNodes {
+		respList = append(respList, node.addr)
+		statuses = append(statuses, c.nodeStatus(node.addr))
+	}
+	return &pb.ListNodesResponse{
+		Nodes:    respList,
+		Statuses: statuses,
+	}, nil
+}
+
+func (c *Coordinator) AddNode(ctx context.Context, rr *pb.AddNodeRequest) (*pb.AddNodeResponse, error) {
+	c.unretire(rr.NodeAddress)
+	summary, err := c.addNode(ctx, rr.NodeAddress, migrationOptionsFromProto(rr.Options), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AddNodeResponse{
+		MigratedFileCount: int32(summary.migrated),
+		FailedFileCount:   int32(len(summary.errors)),
+		Errors:            summary.errors,
+		Completed:         summary.completed,
+	}, nil
+}
+
+func (c *Coordinator) RemoveNode(ctx context.Context, rr *pb.RemoveNodeRequest) (*pb.RemoveNodeResponse, error) {
+	c.retire(rr.NodeAddress)
+	summary, err := c.removeNode(ctx, rr.NodeAddress, migrationOptionsFromProto(rr.Options), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RemoveNodeResponse{
+		MigratedFileCount: int32(summary.migrated),
+		FailedFileCount:   int32(len(summary.errors)),
+		Errors:            summary.errors,
+		Completed:         summary.completed,
+	}, nil
+}
+
+// AddNodeStream is AddNode reporting progress while the migration runs.
+func (c *Coordinator) AddNodeStream(rr *pb.AddNodeRequest, stream pb.VideoContentAdminService_AddNodeStreamServer) error {
+	c.unretire(rr.NodeAddress)
+	return streamMigration(stream.Send, func(progress *progressTracker) (*migrationSummary, error) {
+		return c.addNode(stream.Context(), rr.NodeAddress, migrationOptionsFromProto(rr.Options), progress)
+	})
+}
+
+// RemoveNodeStream is RemoveNode reporting progress while the migration runs.
+func (c *Coordinator) RemoveNodeStream(rr *pb.RemoveNodeRequest, stream pb.VideoContentAdminService_RemoveNodeStreamServer) error {
+	c.retire(rr.NodeAddress)
+	return streamMigration(stream.Send, func(progress *progressTracker) (*migrationSummary, error) {
+		return c.removeNode(stream.Context(), rr.NodeAddress, migrationOptionsFromProto(rr.Options), progress)
+	})
+}
+
+func (c *Coordinator) addNode(ctx context.Context, addr string, opts migrationOptions, progress *progressTracker) (*migrationSummary, error) {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+
+	j, err := c.pendingJournal(opAdd, addr)
+	if err != nil {
+		return nil, err
+	}
+	if j == nil {
+		m, _, err := c.planAdd(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		if m.Src == "" {
+			// empty ring, nothing to migrate
+			newNode, err := dialNode(addr)
+			if err != nil {
+				return nil, err
+			}
+			c.setRing(pb.RingPhase_RING_PHASE_COMMITTED, []node{newNode}, nil)
+			return &migrationSummary{completed: true}, nil
+		}
+		j, err = createJournal(c.journalPath, m)
+		if err != nil {
+			return nil, err
+		}
+		c.pending = j
+	}
+
+	summary, err := c.runMigration(j, opts, progress)
+	if err != nil {
+		return nil, err
+	}
+	if summary.completed {
+		c.pending = nil
+	}
+	return summary, nil
+}
+
+func (c *Coordinator) removeNode(ctx context.Context, addr string, opts migrationOptions, progress *progressTracker) (*migrationSummary, error) {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+
+	j, err := c.pendingJournal(opRemove, addr)
+	if err != nil {
+		return nil, err
+	}
+	if j == nil {
+		m, _, err := c.planRemove(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		j, err = createJournal(c.journalPath, m)
+		if err != nil {
+			return nil, err
+		}
+		c.pending = j
+	}
+
+	summary, err := c.runMigration(j, opts, progress)
+	if err != nil {
+		return nil, err
+	}
+	if summary.completed {
+		c.pending = nil
+	}
+	return summary, nil
+}
+
+// pendingJournal returns the journal of an unfinished migration if it is the
+// same operation as op on addr. A different unfinished migration must be
+// completed first. Must be called with adminMu held.
+func (c *Coordinator) pendingJournal(op string, addr string) (*journal, error) {
+	if c.pending == nil {
+		return nil, nil
+	}
+	if c.pending.m.Op != op || c.pending.m.Node != addr {
+		return nil, fmt.Errorf("the %s of node %s has not finished; re-run it to resume before changing the ring again", c.pending.m.Op, c.pending.m.Node)
+	}
+	return c.pending, nil
+}
+
+// transitionRings returns the ring before and after the change described by
+// m. Both are derived from the current membership, so a migration resumed
+// after a restart gets the same rings whichever of them the coordinator was
+// started with.
+func (c *Coordinator) transitionRings(m migration, src node, dst node) ([]node, []node) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	before := make([]node, 0, len(c.aliveNodes)+1)
+	for _, node := range c.aliveNodes {
+		if m.Op == opAdd && node.addr == m.Node {
+			continue
+		}
+		before = append(before, node)
+	}
+	if m.Op == opRemove && !containsNode(before, m.Node) {
+		before = insertNode(before, src)
+	}
+
+	after := make([]node, 0, len(before)+1)
+	for _, node := range before {
+		if m.Op == opRemove && node.addr == m.Node {
+			continue
+		}
+		after = append(after, node)
+	}
+	if m.Op == opAdd {
+		after = insertNode(after, dst)
+	}
+	return before, after
+}
+
+// setRing switches to a new ring epoch, publishes it and returns its version.
+func (c *Coordinator) setRing(phase pb.RingPhase, nodes []node, other []node) uint64 {
+	c.mu.Lock()
+	c.aliveNodes = nodes
+	c.otherNodes = other
+	c.phase = phase
+	c.version++
+	version := c.version
+	c.mu.Unlock()
+	c.publish()
+	return version
+}
+
+// nodeFor returns the ring member with addr, or dials it if it is not in the ring.
+func (c *Coordinator) nodeFor(addr string) (node, error) {
+	c.mu.RLock()
+	for _, node := range c.aliveNodes {
+		if node.addr == addr {
+			c.mu.RUnlock()
+			return node, nil
+		}
+	}
+	c.mu.RUnlock()
+	return dialNode(addr)
+}
+
+// closeIfDetached closes the connection to n unless n is in the current ring
+// or the one it is transitioning to or from.
+func (c *Coordinator) closeIfDetached(n node) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, node := range c.aliveNodes {
+		if node.conn == n.conn {
+			return
+		}
+	}
+	for _, node := range c.otherNodes {
+		if node.conn == n.conn {
+			return
+		}
+	}
+	n.conn.Close()
+}
+
+// watcher is a WatchRing subscriber, usually a web server.
+type watcher struct {
+	updates chan *pb.RingUpdate
+	applied uint64 // latest ring version it acknowledged, guarded by watchersMu
+}
+
+// WatchRing streams the current ring to the caller, followed by a new
+// snapshot every time the membership changes. The caller acknowledges each
+// version once it routes with it; see waitForWatchers.
+func (c *Coordinator) WatchRing(stream pb.VideoContentAdminService_WatchRingServer) error {
+	w := &watcher{updates: make(chan *pb.RingUpdate, 1)}
+	c.watchersMu.Lock()
+	c.watchers[w] = struct{}{}
+	c.watchersMu.Unlock()
+	defer func() {
+		c.watchersMu.Lock()
+		delete(c.watchers, w)
+		c.notifyAcked()
+		c.watchersMu.Unlock()
+	}()
+
+	go func() {
+		for {
+			ack, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			c.watchersMu.Lock()
+			if ack.AppliedVersion > w.applied {
+				w.applied = ack.AppliedVersion
+				c.notifyAcked()
+			}
+			c.watchersMu.Unlock()
+		}
+	}()
+
+	if err := stream.Send(c.snapshot()); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case update := <-w.updates:
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// notifyAcked wakes up waitForWatchers. Must be called with
+// watchersMu held.
+func (c *Coordinator) notifyAcked() {
+	close(c.acked)
+	c.acked = make(chan struct{})
+}
+
+// waitForWatchers waits until every connected watcher has acknowledged ring
+// version, so none of them still routes with an older one. It gives up after
+// timeout and returns the number of watchers that are behind.
+func (c *Coordinator) waitForWatchers(version uint64, timeout time.Duration) int {
+	deadline := time.After(timeout)
+	for {
+		c.watchersMu.Lock()
+		behind := 0
+		for w := range c.watchers {
+			if w.applied < version {
+				behind++
+			}
+		}
+		changed := c.acked
+		c.watchersMu.Unlock()
+		if behind == 0 {
+			return 0
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return behind
+		}
+	}
+}
+
+// snapshot returns the current ring epoch as a ring update.
+func (c *Coordinator) snapshot() *pb.RingUpdate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	update := &pb.RingUpdate{Version: c.version, Nodes: nodeAddrs(c.aliveNodes), Phase: c.phase}
+	for addr := range c.draining {
+		update.DrainingNodes = append(update.DrainingNodes, addr)
+	}
+	switch c.phase {
+	case pb.RingPhase_RING_PHASE_JOINING:
+		update.NextNodes = nodeAddrs(c.otherNodes)
+	case pb.RingPhase_RING_PHASE_MIGRATING:
+		update.PreviousNodes = nodeAddrs(c.otherNodes)
+	}
+	return update
+}
+
+// publish pushes the current ring to every watcher. Updates are full
+// snapshots, so a watcher that has not consumed the previous one only
+// needs the latest.
+func (c *Coordinator) publish() {
+	update := c.snapshot()
+	probed := append(append(append([]string{}, update.Nodes...), update.NextNodes...), update.PreviousNodes...)
+	c.health.Set(probed)
+	c.watchersMu.Lock()
+	defer c.watchersMu.Unlock()
+	for w := range c.watchers {
+		select {
+		case <-w.updates:
+		default:
+		}
+		w.updates <- update
+	}
+}
+
+func (c *Coordinator) getNodeIndex(addr string) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for idx, node := range c.aliveNodes {
+		if node.addr == addr {
+			return idx, nil
+		}
+	}
+	return -1, errors.New("node not found")
+}
+
+func (c *Coordinator) getNodeForHash(hash uint64) (*node, error) {
+	//assumes a sorted list
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.aliveNodes) == 0 {
+		return nil, ring.ErrNoNodes
+	}
+	nodeToReturn := c.aliveNodes[0] // to loop around
+	for _, node := range c.aliveNodes {
+		if node.hash > hash {
+			nodeToReturn = node
+			break
+		}
+	}
+	return &nodeToReturn, nil
+}
+
+func dialNode(addr string) (node, error) {
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, metrics.DialOptions()...)
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		slog.Error("Failed to connect to storage node", "node", addr, "error", err)
+		return node{}, err
+	}
+	return node{
+		addr:   addr,
+		hash:   ring.HashStringToUint64(addr),
+		client: pb.NewStorageServiceClient(conn),
+		conn:   conn,
+	}, nil
+}
+
+func nodeAddrs(nodes []node) []string {
+	addrs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		addrs = append(addrs, node.addr)
+	}
+	return addrs
+}
+
+func containsNode(nodes []node, addr string) bool {
+	for _, node := range nodes {
+		if node.addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// insertNode adds n to nodes keeping the slice sorted by hash.
+func insertNode(nodes []node, n node) []node {
+	idx := sort.Search(len(nodes), func(i int) bool { return nodes[i].hash >= n.hash })
+	nodes = append(nodes, node{})
+	copy(nodes[idx+1:], nodes[idx:])
+	nodes[idx] = n
+	return nodes
+}
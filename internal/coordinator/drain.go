@@ -0,0 +1,106 @@
+// Node draining: a node stops taking writes and is removed once its data has moved
+
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+	pb "tritontube/internal/proto"
+)
+
+const (
+	nodeStateActive      = "active"
+	nodeStateDraining    = "draining"
+	nodeStateDrainFailed = "drain failed"
+)
+
+type drainStatus struct {
+	progress *progressTracker
+	failure  string // why the last attempt failed, empty while it runs
+}
+
+// DrainNode stops new writes to a node and returns immediately. Its data is
+// migrated in the background to the nodes that will own it, and the node is
+// removed from the ring once that is done. Draining a node whose drain failed
+// resumes it.
+func (c *Coordinator) DrainNode(ctx context.Context, rr *pb.DrainNodeRequest) (*pb.DrainNodeResponse, error) {
+	if err := c.startDrain(rr.NodeAddress, migrationOptionsFromProto(rr.Options)); err != nil {
+		return nil, err
+	}
+	c.retire(rr.NodeAddress)
+	return &pb.DrainNodeResponse{}, nil
+}
+
+// startDrain marks addr as draining and starts moving its data off.
+func (c *Coordinator) startDrain(addr string, opts migrationOptions) error {
+	if _, err := c.getNodeIndex(addr); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if status, ok := c.draining[addr]; ok && status.failure == "" {
+		c.mu.Unlock()
+		return fmt.Errorf("node %s is already draining", addr)
+	}
+	if _, ok := c.draining[addr]; !ok && len(c.aliveNodes)-len(c.draining) <= 1 {
+		c.mu.Unlock()
+		return fmt.Errorf("cannot drain %s: it is the last active node in the ring", addr)
+	}
+	status := &drainStatus{progress: &progressTracker{}}
+	c.draining[addr] = status
+	c.version++
+	c.mu.Unlock()
+	// web servers stop writing to the node as soon as they see this
+	c.publish()
+
+	go c.drain(addr, status, opts)
+	return nil
+}
+
+func (c *Coordinator) drain(addr string, status *drainStatus, opts migrationOptions) {
+	slog.Info("Draining node", "node", addr)
+	summary, err := c.removeNode(context.Background(), addr, opts, status.progress)
+
+	c.mu.Lock()
+	switch {
+	case err == nil && summary.completed:
+		delete(c.draining, addr)
+		slog.Info("Drained and removed node", "node", addr, "migrated", summary.migrated)
+	case !containsNode(c.aliveNodes, addr):
+		// removed by someone else meanwhile
+		delete(c.draining, addr)
+	case err != nil:
+		status.failure = err.Error()
+	default:
+		status.failure = fmt.Sprintf("%d files failed to migrate; drain again to resume", len(summary.errors))
+	}
+	if status.failure != "" {
+		slog.Error("Draining node failed", "node", addr, "error", status.failure)
+	}
+	c.mu.Unlock()
+}
+
+// nodeStatus describes addr for ListNodes. Must be called with mu held.
+func (c *Coordinator) nodeStatus(addr string) *pb.NodeStatus {
+	status := &pb.NodeStatus{Address: addr, State: nodeStateActive}
+	state, detail := c.health.Describe(addr)
+	status.Health = string(state)
+	status.HealthDetail = detail
+	if m, ok := c.members[addr]; ok {
+		status.Registered = true
+		status.CapacityBytes = m.capacity
+		status.LastHeartbeatMsAgo = time.Since(m.lastHeartbeat).Milliseconds()
+	}
+	drain, ok := c.draining[addr]
+	switch {
+	case !ok:
+	case drain.failure != "":
+		status.State = nodeStateDrainFailed
+		status.Detail = drain.failure
+	default:
+		status.State = nodeStateDraining
+		status.Detail = drain.progress.describe()
+	}
+	return status
+}
@@ -0,0 +1,180 @@
+// Migration engine: bounded concurrency, rate limiting, timeouts and retries
+
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	pb "tritontube/internal/proto"
+	"tritontube/internal/retry"
+)
+
+// migrationOptions controls how hard a migration pushes the storage nodes.
+type migrationOptions struct {
+	concurrency    int           // files copied at once
+	bytesPerSecond int64         // migrated bytes per second, 0 for unlimited
+	rpcTimeout     time.Duration // deadline for each storage RPC
+	maxRetries     int           // retries after the first attempt of each RPC
+	retryBackoff   time.Duration // wait before the first retry, doubled after each one
+}
+
+var defaultMigrationOptions = migrationOptions{
+	concurrency:    4,
+	bytesPerSecond: 0,
+	rpcTimeout:     30 * time.Second,
+	maxRetries:     3,
+	retryBackoff:   200 * time.Millisecond,
+}
+
+// migrationOptionsFromProto fills the unset fields of o with the defaults.
+// Negative values count as unset.
+func migrationOptionsFromProto(o *pb.MigrationOptions) migrationOptions {
+	opts := defaultMigrationOptions
+	if o == nil {
+		return opts
+	}
+	if o.Concurrency > 0 {
+		opts.concurrency = int(o.Concurrency)
+	}
+	if o.BytesPerSecond > 0 {
+		opts.bytesPerSecond = o.BytesPerSecond
+	}
+	if o.RpcTimeoutMs > 0 {
+		opts.rpcTimeout = time.Duration(o.RpcTimeoutMs) * time.Millisecond
+	}
+	// 0 retries or backoff is a choice, not a missing value
+	if o.MaxRetries != nil && *o.MaxRetries >= 0 {
+		opts.maxRetries = int(*o.MaxRetries)
+	}
+	if o.RetryBackoffMs != nil && *o.RetryBackoffMs >= 0 {
+		opts.retryBackoff = time.Duration(*o.RetryBackoffMs) * time.Millisecond
+	}
+	return opts
+}
+
+type migrationEngine struct {
+	opts    migrationOptions
+	limiter *rateLimiter
+}
+
+func newMigrationEngine(opts migrationOptions) *migrationEngine {
+	return &migrationEngine{
+		opts:    opts,
+		limiter: &rateLimiter{bytesPerSecond: opts.bytesPerSecond},
+	}
+}
+
+// forEach runs fn on every file with at most opts.concurrency running at once
+// and returns one error per failed file.
+func (e *migrationEngine) forEach(files []string, fn func(file string) error) []*pb.MigrationError {
+	errs := make([]*pb.MigrationError, 0)
+	var errsMu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan string)
+	for i := 0; i < e.opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range work {
+				if err := fn(file); err != nil {
+					errsMu.Lock()
+					errs = append(errs, &pb.MigrationError{File: file, Error: err.Error()})
+					errsMu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, file := range files {
+		work <- file
+	}
+	close(work)
+	wg.Wait()
+	return errs
+}
+
+// call runs one storage RPC with the per-RPC deadline, retrying failures
+// another attempt may fix with exponential backoff.
+func (e *migrationEngine) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := e.opts.retryBackoff
+	var err error
+	attempt := 0
+	for ; ; attempt++ {
+		// a cancelled migration stops here instead of failing the RPC
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rpcCtx, cancel := context.WithTimeout(ctx, e.opts.rpcTimeout)
+		err = fn(rpcCtx)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || attempt == e.opts.maxRetries || !retry.Retryable(err) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if err != nil && attempt > 0 {
+		return fmt.Errorf("%w (after %d retries)", err, attempt)
+	}
+	return err
+}
+
+// listFiles pages through the files a node lists for req, retrying each
+// page like any other storage RPC.
+func (e *migrationEngine) listFiles(ctx context.Context, client pb.StorageServiceClient, req *pb.ListRequest) ([]*pb.FileInfo, error) {
+	infos := make([]*pb.FileInfo, 0)
+	for {
+		var data *pb.ListResponse
+		err := e.call(ctx, func(ctx context.Context) error {
+			var err error
+			data, err = client.List(ctx, req)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, data.Infos...)
+		if data.NextPageToken == "" {
+			return infos, nil
+		}
+		req.PageToken = data.NextPageToken
+	}
+}
+
+// rateLimiter spaces out transfers so that on average no more than
+// bytesPerSecond are moved. Each transfer reserves the next free slot of
+// time proportional to its size and waits for it to start.
+type rateLimiter struct {
+	bytesPerSecond int64
+	mu             sync.Mutex
+	next           time.Time
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l.bytesPerSecond <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	start := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSecond) * float64(time.Second)))
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(start)):
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallRetriesOnlyTransientErrors(t *testing.T) {
+	engine := newMigrationEngine(migrationOptions{concurrency: 1, rpcTimeout: time.Second, maxRetries: 3, retryBackoff: time.Millisecond})
+	for code, want := range map[codes.Code]int{codes.Unavailable: 4, codes.NotFound: 1, codes.DataLoss: 1} {
+		attempts := 0
+		err := engine.call(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return status.Error(code, "failed")
+		})
+		if status.Code(err) != code {
+			t.Errorf("%v: got error %v", code, err)
+		}
+		if attempts != want {
+			t.Errorf("%v: %d attempts, want %d", code, attempts, want)
+		}
+	}
+}
+
+func TestCallStopsWhenCancelled(t *testing.T) {
+	engine := newMigrationEngine(migrationOptions{concurrency: 1, rpcTimeout: time.Second, maxRetries: 3, retryBackoff: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := engine.call(ctx, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return status.Error(codes.Canceled, "context canceled")
+	})
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want context.Canceled after 1", err, attempts)
+	}
+	err = engine.call(ctx, func(ctx context.Context) error {
+		t.Error("RPC attempted after cancel")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Migration journal so an interrupted AddNode/RemoveNode can resume
+
+package coordinator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	opAdd    = "add"
+	opRemove = "remove"
+)
+
+const (
+	eventAdded     = "added" // a file written to the source after the migration started
+	eventCopied    = "copied"
+	eventCommitted = "committed"
+	eventDeleted   = "deleted"
+	eventGone      = "gone" // a file deleted from the source before it was copied
+)
+
+// migration describes one AddNode/RemoveNode: Files move from Src to Dst.
+type migration struct {
+	Op    string   `json:"op"`
+	Node  string   `json:"node"`
+	Src   string   `json:"src"`
+	Dst   string   `json:"dst"`
+	Files []string `json:"files"`
+}
+
+// journal is an append-only file. The first line is the migration as JSON and
+// every following line records one step as "<event> <file>". Each line is
+// fsynced before the step it records is considered done.
+type journal struct {
+	path      string
+	mu        sync.Mutex // record is called from concurrent migration workers
+	f         *os.File
+	m         migration
+	copied    map[string]bool
+	deleted   map[string]bool
+	committed bool
+}
+
+func createJournal(path string, m migration) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal %s: %w", path, err)
+	}
+	header, err := json.Marshal(m)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Write(append(header, '\n')); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write journal %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to sync journal %s: %w", path, err)
+	}
+	return &journal{
+		path:    path,
+		f:       f,
+		m:       m,
+		copied:  make(map[string]bool),
+		deleted: make(map[string]bool),
+	}, nil
+}
+
+// openJournal loads the journal left behind by an unfinished migration.
+// It returns nil if there is none.
+func openJournal(path string) (*journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+	// the last element is either empty or a line torn by a crash; skip it
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("journal %s has no header", path)
+	}
+	j := &journal{
+		path:    path,
+		copied:  make(map[string]bool),
+		deleted: make(map[string]bool),
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &j.m); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %w", path, err)
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		event, file, _ := strings.Cut(line, " ")
+		j.apply(event, file)
+	}
+	j.f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+func (j *journal) record(event string, file string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := fmt.Fprintf(j.f, "%s %s\n", event, file); err != nil {
+		return fmt.Errorf("failed to write journal %s: %w", j.path, err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal %s: %w", j.path, err)
+	}
+	j.apply(event, file)
+	return nil
+}
+
+func (j *journal) apply(event string, file string) {
+	switch event {
+	case eventAdded:
+		j.m.Files = append(j.m.Files, file)
+	case eventCopied:
+		j.copied[file] = true
+	case eventCommitted:
+		j.committed = true
+	case eventDeleted:
+		j.deleted[file] = true
+	case eventGone:
+		// nothing left to copy or delete
+		j.copied[file] = true
+		j.deleted[file] = true
+	}
+}
+
+func (j *journal) pendingCopies() []string {
+	pending := make([]string, 0)
+	for _, file := range j.m.Files {
+		if !j.copied[file] {
+			pending = append(pending, file)
+		}
+	}
+	return pending
+}
+
+func (j *journal) pendingDeletes() []string {
+	pending := make([]string, 0)
+	for _, file := range j.m.Files {
+		if !j.deleted[file] {
+			pending = append(pending, file)
+		}
+	}
+	return pending
+}
+
+// finish removes the journal once the migration is complete.
+func (j *journal) finish() error {
+	j.f.Close()
+	if err := os.Remove(j.path); err != nil {
+		return fmt.Errorf("failed to remove journal %s: %w", j.path, err)
+	}
+	return nil
+}
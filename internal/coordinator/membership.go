@@ -0,0 +1,152 @@
+// Storage node self-registration and heartbeats
+
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	pb "tritontube/internal/proto"
+)
+
+// how often registered storage nodes send heartbeats, and how often the
+// coordinator checks on them
+const heartbeatInterval = 2 * time.Second
+
+// member is a storage node that registered itself. Registered nodes that are
+// alive are added to the ring; nodes in the ring whose heartbeats stop for
+// longer than heartbeatGrace are drained so their keys move to other nodes.
+type member struct {
+	capacity      int64
+	lastHeartbeat time.Time
+	adding        bool // an add of the node is running
+	reassigning   bool // drained because its heartbeats stopped
+	// removed or drained by an operator, so it is not added back until it
+	// registers again or is added by hand
+	retired bool
+}
+
+// Register records a storage node started with -coordinator. It is added to
+// the ring in the background.
+func (c *Coordinator) Register(ctx context.Context, rr *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	if rr.NodeAddress == "" {
+		return nil, errors.New("node address is required")
+	}
+	c.mu.Lock()
+	m, ok := c.members[rr.NodeAddress]
+	if !ok {
+		m = &member{}
+		c.members[rr.NodeAddress] = m
+	}
+	m.capacity = rr.CapacityBytes
+	m.lastHeartbeat = time.Now()
+	m.retired = false
+	c.mu.Unlock()
+	slog.InfoContext(ctx, "Storage node registered", "node", rr.NodeAddress, "capacity_bytes", rr.CapacityBytes)
+
+	go c.checkMembers()
+	return &pb.RegisterResponse{HeartbeatIntervalMs: heartbeatInterval.Milliseconds()}, nil
+}
+
+func (c *Coordinator) Heartbeat(ctx context.Context, rr *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.members[rr.NodeAddress]
+	if !ok {
+		return &pb.HeartbeatResponse{Registered: false}, nil
+	}
+	m.lastHeartbeat = time.Now()
+	return &pb.HeartbeatResponse{Registered: true}, nil
+}
+
+// retire stops addr from being added back automatically.
+func (c *Coordinator) retire(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.members[addr]; ok {
+		m.retired = true
+	}
+}
+
+func (c *Coordinator) unretire(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.members[addr]; ok {
+		m.retired = false
+	}
+}
+
+func (c *Coordinator) monitorMembers() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopMonitor:
+			return
+		case <-ticker.C:
+			c.checkMembers()
+		}
+	}
+}
+
+// checkMembers adds registered nodes that are alive and not yet in the ring,
+// and drains nodes in the ring that stopped sending heartbeats. Writes move to
+// other nodes as soon as the drain starts, but the node's files can only be
+// copied off once it is reachable, so a failed drain is resumed when its
+// heartbeats come back. Once drained the node is forgotten if it is still
+// dead, or added back like a newly registered node.
+func (c *Coordinator) checkMembers() {
+	toAdd := make([]string, 0)
+	toDrain := make([]string, 0)
+	c.mu.Lock()
+	for addr, m := range c.members {
+		alive := time.Since(m.lastHeartbeat) <= c.heartbeatGrace
+		inRing := containsNode(c.aliveNodes, addr)
+		status, draining := c.draining[addr]
+		switch {
+		case !inRing && alive && !m.adding && !m.retired:
+			m.adding = true
+			m.reassigning = false
+			toAdd = append(toAdd, addr)
+		case !inRing && !alive && !m.adding:
+			delete(c.members, addr)
+		case inRing && !alive && !draining:
+			m.reassigning = true
+			toDrain = append(toDrain, addr)
+		case inRing && alive && m.reassigning && draining && status.failure != "":
+			toDrain = append(toDrain, addr)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, addr := range toAdd {
+		go c.addMember(addr)
+	}
+	for _, addr := range toDrain {
+		slog.Warn("Reassigning the data of a storage node that stopped sending heartbeats", "node", addr, "grace", c.heartbeatGrace)
+		if err := c.startDrain(addr, defaultMigrationOptions); err != nil {
+			slog.Error("Failed to drain node", "node", addr, "error", err)
+		}
+	}
+}
+
+// addMember adds a registered node to the ring. If the add does not complete
+// the next check retries it.
+func (c *Coordinator) addMember(addr string) {
+	slog.Info("Adding registered storage node", "node", addr)
+	summary, err := c.addNode(context.Background(), addr, defaultMigrationOptions, nil)
+	switch {
+	case err != nil:
+		slog.Error("Failed to add registered node", "node", addr, "error", err)
+	case !summary.completed:
+		slog.Warn("Adding registered node is incomplete", "node", addr, "failed", len(summary.errors))
+	default:
+		slog.Info("Added registered node", "node", addr, "migrated", summary.migrated)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.members[addr]; ok {
+		m.adding = false
+	}
+}
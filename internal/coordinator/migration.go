@@ -0,0 +1,294 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
+	"tritontube/internal/metrics"
+	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// how long to wait for web servers to acknowledge a new ring epoch before
+// giving up on the phase that relies on them having switched to it
+const ringAckTimeout = 30 * time.Second
+
+type migrationSummary struct {
+	migrated  int
+	errors    []*pb.MigrationError
+	completed bool
+}
+
+// moveRequest lists the files on src that change owner when op is applied
+// to node: all of them for a remove, and for an add every file src would not
+// keep, i.e. those hashing outside (node, src].
+func moveRequest(op string, nodeAddr string, srcAddr string) *pb.ListRequest {
+	if op == opRemove {
+		return &pb.ListRequest{}
+	}
+	return &pb.ListRequest{
+		HashRange: true,
+		HashStart: ring.HashStringToUint64(srcAddr),
+		HashEnd:   ring.HashStringToUint64(nodeAddr),
+	}
+}
+
+// fileNames returns the names of the listed files.
+func fileNames(infos []*pb.FileInfo) []string {
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+// runMigration drives a journaled migration to completion through the ring
+// phases. While JOINING the old ring keeps ownership and web servers write to
+// both owners; every pending file is copied to the destination and verified.
+// Only once all copies are verified is ownership moved (MIGRATING), and the
+// source copies are deleted before the ring settles (COMMITTED). If any copy
+// fails the old ring is restored and the journal is kept, so running the same
+// admin command again resumes where this one stopped. The journal is kept too
+// if a source copy fails to delete, though the new ring stays committed.
+// Copying and deleting each wait until every web server watching the ring
+// has acknowledged the phase they rely on; if one does not in time, the
+// migration stops there the same way.
+func (c *Coordinator) runMigration(j *journal, opts migrationOptions, progress *progressTracker) (*migrationSummary, error) {
+	ctx := context.Background() // the migration must not be cut short by the admin client going away
+	if progress == nil {
+		// nobody is watching, but the progress still feeds the metrics
+		progress = &progressTracker{}
+	}
+	metrics.MigrationInProgress.Inc()
+	defer metrics.MigrationInProgress.Dec()
+	engine := newMigrationEngine(opts)
+	src, err := c.nodeFor(j.m.Src)
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeIfDetached(src)
+	dst, err := c.nodeFor(j.m.Dst)
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeIfDetached(dst)
+	before, after := c.transitionRings(j.m, src, dst)
+
+	summary := &migrationSummary{}
+	if !j.committed {
+		version := c.setRing(pb.RingPhase_RING_PHASE_JOINING, before, after)
+		progress.setStage(stageJoining, 0)
+		// a web server still on the old ring would write only to the source
+		// after the copy has listed it
+		if behind := c.waitForWatchers(version, ringAckTimeout); behind > 0 {
+			ackErr := ringAckError(behind, version)
+			progress.fileFailed(ackErr)
+			c.setRing(pb.RingPhase_RING_PHASE_COMMITTED, before, nil)
+			summary.errors = append(summary.errors, ackErr)
+			summary.migrated = len(j.copied)
+			return summary, nil
+		}
+		slog.Info("Copying files", "op", j.m.Op, "node", j.m.Node, "files", len(j.pendingCopies()), "src", src.addr, "dst", dst.addr, "workers", opts.concurrency)
+		progress.setStage(stageCopying, len(j.pendingCopies()))
+		summary.errors = copyFiles(ctx, engine, progress, j, src, dst, j.pendingCopies())
+
+		// catch files written to the source before every web server saw the
+		// JOINING ring and started writing to both owners
+		if len(summary.errors) == 0 {
+			infos, err := engine.listFiles(ctx, src.client, moveRequest(j.m.Op, j.m.Node, j.m.Src))
+			if err != nil {
+				listErr := &pb.MigrationError{Error: fmt.Sprintf("list source: %v", err)}
+				progress.fileFailed(listErr)
+				summary.errors = append(summary.errors, listErr)
+			} else {
+				tracked := make(map[string]bool, len(j.m.Files))
+				for _, file := range j.m.Files {
+					tracked[file] = true
+				}
+				late := make([]string, 0)
+				for _, file := range fileNames(infos) {
+					if tracked[file] {
+						continue
+					}
+					if err := j.record(eventAdded, file); err != nil {
+						return nil, err
+					}
+					late = append(late, file)
+				}
+				progress.addFiles(len(late))
+				summary.errors = copyFiles(ctx, engine, progress, j, src, dst, late)
+			}
+		}
+		if len(summary.errors) > 0 {
+			c.setRing(pb.RingPhase_RING_PHASE_COMMITTED, before, nil)
+			summary.migrated = len(j.copied)
+			return summary, nil
+		}
+	}
+	version := c.setRing(pb.RingPhase_RING_PHASE_MIGRATING, after, before)
+	if !j.committed {
+		if err := j.record(eventCommitted, ""); err != nil {
+			return nil, err
+		}
+	}
+	progress.setStage(stageDeleting, len(j.pendingDeletes()))
+	// a web server still on an older ring may read from or write to the old
+	// owners only, so their copies stay until every one has switched
+	if behind := c.waitForWatchers(version, ringAckTimeout); behind > 0 {
+		ackErr := ringAckError(behind, version)
+		progress.fileFailed(ackErr)
+		c.setRing(pb.RingPhase_RING_PHASE_COMMITTED, after, nil)
+		summary.errors = append(summary.errors, ackErr)
+		summary.migrated = len(j.m.Files)
+		return summary, nil
+	}
+
+	// the destination now owns every file; a failed delete leaves a stray
+	// duplicate behind on the source until the migration is resumed
+	summary.errors = engine.forEach(j.pendingDeletes(), func(file string) error {
+		err := engine.call(ctx, func(ctx context.Context) error {
+			_, err := src.client.Remove(ctx, &pb.RemoveRequest{VideoId: path.Dir(file), FileName: path.Base(file)})
+			if status.Code(err) == codes.NotFound {
+				// already deleted, e.g. along with its video
+				return nil
+			}
+			return err
+		})
+		if err == nil {
+			err = j.record(eventDeleted, file)
+		}
+		if err != nil {
+			slog.Warn("Failed to remove migrated file", "file", file, "src", src.addr, "error", err)
+			err = fmt.Errorf("remove from source: %w", err)
+			progress.fileFailed(&pb.MigrationError{File: file, Error: err.Error()})
+			return err
+		}
+		progress.fileDone(0)
+		return nil
+	})
+	c.setRing(pb.RingPhase_RING_PHASE_COMMITTED, after, nil)
+	summary.migrated = len(j.m.Files)
+	if len(summary.errors) > 0 {
+		// keep the journal so running the command again deletes the leftovers
+		slog.Warn("Migration committed with files left on the source", "op", j.m.Op, "node", j.m.Node, "src", src.addr, "files", len(summary.errors))
+		return summary, nil
+	}
+	summary.completed = true
+	return summary, j.finish()
+}
+
+// ringAckError reports web servers that did not switch to ring version in time.
+func ringAckError(behind int, version uint64) *pb.MigrationError {
+	return &pb.MigrationError{Error: fmt.Sprintf("%d web servers did not switch to ring version %d within %v", behind, version, ringAckTimeout)}
+}
+
+// copyFiles copies and verifies files, recording each success in the journal.
+func copyFiles(ctx context.Context, engine *migrationEngine, progress *progressTracker, j *journal, src node, dst node, files []string) []*pb.MigrationError {
+	return engine.forEach(files, func(file string) error {
+		size, err := copyAndVerify(ctx, engine, src.client, dst.client, file)
+		switch {
+		case errors.Is(err, errGone):
+			// deleted since it was listed, e.g. along with its video, so it
+			// must not hold up the migration on every resume
+			slog.Info("Skipping file deleted from the source", "file", file, "src", src.addr)
+			if err = j.record(eventGone, file); err == nil {
+				progress.fileDone(0)
+				return nil
+			}
+		case err == nil:
+			err = j.record(eventCopied, file)
+		}
+		if err != nil {
+			slog.Warn("Failed to migrate file", "file", file, "src", src.addr, "dst", dst.addr, "error", err)
+			progress.fileFailed(&pb.MigrationError{File: file, Error: err.Error()})
+			return err
+		}
+		progress.fileDone(size)
+		return nil
+	})
+}
+
+// errGone is returned by copyAndVerify for a file no longer on the source.
+var errGone = errors.New("file no longer exists on the source")
+
+// copyAndVerify copies file from src to dst and checks that dst now holds
+// exactly the bytes read from src.
+func copyAndVerify(ctx context.Context, engine *migrationEngine, src pb.StorageServiceClient, dst pb.StorageServiceClient, file string) (int, error) {
+	videoID := path.Dir(file)   // "videoId"
+	fileName := path.Base(file) // "file.mxx"
+	// reserve the transfer before reading, so the source is not read any
+	// faster than the migration may move data
+	var srcStat *pb.StatResponse
+	err := engine.call(ctx, func(ctx context.Context) error {
+		var err error
+		srcStat, err = src.Stat(ctx, &pb.StatRequest{VideoId: videoID, FileName: fileName})
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return 0, errGone
+	}
+	if err != nil {
+		return 0, fmt.Errorf("stat on source: %w", err)
+	}
+	if err := engine.limiter.wait(ctx, int(srcStat.Size)); err != nil {
+		return 0, err
+	}
+	var fileData, storedSum []byte
+	err = engine.call(ctx, func(ctx context.Context) error {
+		resp, err := src.Read(ctx, &pb.ReadRequest{VideoId: videoID, FileName: fileName})
+		if err == nil {
+			fileData = resp.FileData
+			storedSum = resp.Sha256
+		}
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return 0, errGone
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read from source: %w", err)
+	}
+	want := sha256.Sum256(fileData)
+	// never spread a copy that is already corrupt on the source
+	if len(storedSum) > 0 && !bytes.Equal(storedSum, want[:]) {
+		return 0, errors.New("checksum mismatch on source")
+	}
+	if grown := len(fileData) - int(srcStat.Size); grown > 0 {
+		// written to since the stat; the extra bytes still count
+		if err := engine.limiter.wait(ctx, grown); err != nil {
+			return 0, err
+		}
+	}
+	err = engine.call(ctx, func(ctx context.Context) error {
+		_, err := dst.Write(ctx, &pb.WriteRequest{VideoId: videoID, FileName: fileName, FileData: fileData, Sha256: want[:]})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("write to destination: %w", err)
+	}
+	// have the destination re-hash what it stored rather than reading it back
+	var stat *pb.StatResponse
+	err = engine.call(ctx, func(ctx context.Context) error {
+		var err error
+		stat, err = dst.Stat(ctx, &pb.StatRequest{VideoId: videoID, FileName: fileName, Verify: true})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("verify on destination: %w", err)
+	}
+	if stat.Size != int64(len(fileData)) {
+		return 0, fmt.Errorf("size mismatch: source has %d bytes, destination has %d", len(fileData), stat.Size)
+	}
+	if !bytes.Equal(stat.Sha256, want[:]) {
+		return 0, errors.New("checksum mismatch on destination")
+	}
+	return len(fileData), nil
+}
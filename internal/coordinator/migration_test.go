@@ -0,0 +1,146 @@
+package coordinator
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
+	"tritontube/internal/storage"
+
+	"google.golang.org/grpc"
+)
+
+// startNode serves a storage node backed by a temporary directory.
+func startNode(t *testing.T) (string, *storage.FSBackend) {
+	dir := t.TempDir()
+	backend, err := storage.NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterStorageServiceServer(srv, storage.NewStorageService(dir, backend))
+	go srv.Serve(lis)
+	t.Cleanup(func() {
+		srv.Stop()
+		backend.Close()
+	})
+	return lis.Addr().String(), backend
+}
+
+// startAdd starts adding a new node to a one-node ring holding files of
+// which a few move, and returns the journal before any step is taken.
+func startAdd(t *testing.T) (*Coordinator, *storage.FSBackend, *storage.FSBackend, *journal) {
+	srcAddr, src := startNode(t)
+	dstAddr, dst := startNode(t)
+	// the ring positions depend on the ports, so write files until enough
+	// of them hash to the new node
+	after := ring.New(0, []string{srcAddr, dstAddr})
+	moving := 0
+	for i := 0; moving < 3 || i < 10; i++ {
+		file := fmt.Sprintf("video%d/seg.m4s", i)
+		data := []byte(fmt.Sprintf("segment %d", i))
+		sum := sha256.Sum256(data)
+		if err := src.Write(file, data, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+		if owner, _ := after.NodeForKey(file); owner.Addr == dstAddr {
+			moving++
+		}
+	}
+
+	c, err := NewCoordinator([]string{srcAddr}, filepath.Join(t.TempDir(), "journal"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	m, _, err := c.planAdd(context.Background(), dstAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != moving {
+		t.Fatalf("%d files move to the new node, want %d", len(m.Files), moving)
+	}
+	j, err := createJournal(c.journalPath, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pending = j
+	return c, src, dst, j
+}
+
+func resumeAdd(t *testing.T, c *Coordinator, j *journal) {
+	summary, err := c.addNode(context.Background(), j.m.Node, defaultMigrationOptions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.completed || len(summary.errors) > 0 {
+		t.Fatalf("migration not completed: %v", summary.errors)
+	}
+	if c.pending != nil {
+		t.Error("migration still pending")
+	}
+	if _, err := os.Stat(c.journalPath); !os.IsNotExist(err) {
+		t.Errorf("journal not removed: %v", err)
+	}
+}
+
+func TestResumeSkipsFileDeletedBeforeCopy(t *testing.T) {
+	c, src, dst, j := startAdd(t)
+	gone := j.m.Files[0]
+	if err := src.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	resumeAdd(t, c, j)
+	for _, file := range j.m.Files {
+		_, err := dst.Stat(file)
+		if file == gone && err == nil {
+			t.Errorf("%s was copied after being deleted", file)
+		}
+		if file != gone && err != nil {
+			t.Errorf("%s not copied: %v", file, err)
+		}
+	}
+}
+
+func TestResumeSkipsFileDeletedAfterCopy(t *testing.T) {
+	c, src, dst, j := startAdd(t)
+	// copy every file and commit, as if the coordinator crashed while
+	// deleting from the source
+	for _, file := range j.m.Files {
+		data, sum, err := src.Read(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dst.Write(file, data, sum); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.record(eventCopied, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.record(eventCommitted, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Remove(j.m.Files[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	resumeAdd(t, c, j)
+	for _, file := range j.m.Files {
+		if _, err := src.Stat(file); err == nil {
+			t.Errorf("%s not deleted from the source", file)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Rebalance planning: what AddNode/RemoveNode would move
+
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
+)
+
+// PlanAddNode reports which files adding a node would move, without changing anything.
+func (c *Coordinator) PlanAddNode(ctx context.Context, rr *pb.AddNodeRequest) (*pb.MigrationPlan, error) {
+	m, sizes, err := c.planAdd(ctx, rr.NodeAddress)
+	if err != nil {
+		return nil, err
+	}
+	return buildPlan(m, sizes), nil
+}
+
+// PlanRemoveNode reports which files removing a node would move, without changing anything.
+func (c *Coordinator) PlanRemoveNode(ctx context.Context, rr *pb.RemoveNodeRequest) (*pb.MigrationPlan, error) {
+	m, sizes, err := c.planRemove(ctx, rr.NodeAddress)
+	if err != nil {
+		return nil, err
+	}
+	return buildPlan(m, sizes), nil
+}
+
+// planAdd works out the migration adding addr would run, along with the size
+// of every file on the source. An empty Src means the ring is empty and
+// nothing moves.
+func (c *Coordinator) planAdd(ctx context.Context, addr string) (migration, map[string]int64, error) {
+	if _, err := c.getNodeIndex(addr); err == nil {
+		return migration{}, nil, fmt.Errorf("node %s is already in the ring", addr)
+	}
+	// get the node's location in the ring
+	successorNode, err := c.getNodeForHash(ring.HashStringToUint64(addr))
+	if err != nil {
+		return migration{Op: opAdd, Node: addr, Dst: addr}, nil, nil
+	}
+	// list the part of the successor's data that moves to the new node
+	infos, err := newMigrationEngine(defaultMigrationOptions).listFiles(ctx, successorNode.client, moveRequest(opAdd, addr, successorNode.addr))
+	if err != nil {
+		return migration{}, nil, fmt.Errorf("failed to list files on %s: %w", successorNode.addr, err)
+	}
+	return migration{
+		Op:    opAdd,
+		Node:  addr,
+		Src:   successorNode.addr,
+		Dst:   addr,
+		Files: fileNames(infos),
+	}, fileSizes(infos), nil
+}
+
+// planRemove works out the migration removing addr would run, along with the
+// size of every file on it.
+func (c *Coordinator) planRemove(ctx context.Context, addr string) (migration, map[string]int64, error) {
+	currentNodeIdx, err := c.getNodeIndex(addr)
+	if err != nil {
+		return migration{}, nil, err
+	}
+	c.mu.RLock()
+	if len(c.aliveNodes) == 1 {
+		c.mu.RUnlock()
+		return migration{}, nil, fmt.Errorf("cannot remove %s: it is the last node in the ring", addr)
+	}
+	currentNode, successorNode := c.aliveNodes[currentNodeIdx], c.aliveNodes[(currentNodeIdx+1)%len(c.aliveNodes)]
+	c.mu.RUnlock()
+	// everything on the node moves to its successor
+	infos, err := newMigrationEngine(defaultMigrationOptions).listFiles(ctx, currentNode.client, moveRequest(opRemove, addr, currentNode.addr))
+	if err != nil {
+		return migration{}, nil, fmt.Errorf("failed to list files on %s: %w", currentNode.addr, err)
+	}
+	return migration{
+		Op:    opRemove,
+		Node:  addr,
+		Src:   currentNode.addr,
+		Dst:   successorNode.addr,
+		Files: fileNames(infos),
+	}, fileSizes(infos), nil
+}
+
+func fileSizes(infos []*pb.FileInfo) map[string]int64 {
+	sizes := make(map[string]int64, len(infos))
+	for _, info := range infos {
+		sizes[info.Name] = info.Size
+	}
+	return sizes
+}
+
+func buildPlan(m migration, sizes map[string]int64) *pb.MigrationPlan {
+	plan := &pb.MigrationPlan{Moves: make([]*pb.PlannedMove, 0)}
+	if len(m.Files) == 0 {
+		return plan
+	}
+	move := &pb.PlannedMove{Src: m.Src, Dst: m.Dst, Files: m.Files}
+	for _, file := range m.Files {
+		move.Bytes += sizes[file]
+	}
+	plan.Moves = append(plan.Moves, move)
+	plan.TotalFiles = int32(len(m.Files))
+	plan.TotalBytes = move.Bytes
+	return plan
+}
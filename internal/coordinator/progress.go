@@ -0,0 +1,167 @@
+// Migration progress reporting for AddNodeStream/RemoveNodeStream
+
+package coordinator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"tritontube/internal/metrics"
+	pb "tritontube/internal/proto"
+)
+
+// how often a streaming migration reports progress
+const progressInterval = 500 * time.Millisecond
+
+const (
+	stageJoining  = "joining"
+	stageCopying  = "copying"
+	stageDeleting = "deleting"
+	stageDone     = "done"
+)
+
+// progressTracker collects the progress of a running migration and mirrors
+// it in the migration metrics. A nil tracker ignores every update.
+type progressTracker struct {
+	mu               sync.Mutex
+	stage            string
+	filesTotal       int
+	filesDone        int
+	filesFailed      int
+	bytesMoved       int64
+	stageStart       time.Time
+	stageStartBytes  int64
+	unreportedErrors []*pb.MigrationError
+}
+
+// setStage starts a new stage over total files.
+func (p *progressTracker) setStage(stage string, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage = stage
+	p.filesTotal = total
+	p.filesDone = 0
+	p.filesFailed = 0
+	p.stageStart = time.Now()
+	p.stageStartBytes = p.bytesMoved
+	metrics.MigrationStageFiles.WithLabelValues("total").Set(float64(total))
+	metrics.MigrationStageFiles.WithLabelValues("done").Set(0)
+	metrics.MigrationStageFiles.WithLabelValues("failed").Set(0)
+}
+
+// addFiles grows the current stage by n files.
+func (p *progressTracker) addFiles(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filesTotal += n
+	metrics.MigrationStageFiles.WithLabelValues("total").Add(float64(n))
+}
+
+func (p *progressTracker) fileDone(bytes int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filesDone++
+	p.bytesMoved += int64(bytes)
+	metrics.MigrationStageFiles.WithLabelValues("done").Inc()
+	metrics.MigrationFiles.WithLabelValues("done").Inc()
+	metrics.MigrationBytes.Add(float64(bytes))
+}
+
+func (p *progressTracker) fileFailed(e *pb.MigrationError) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filesFailed++
+	p.unreportedErrors = append(p.unreportedErrors, e)
+	metrics.MigrationStageFiles.WithLabelValues("failed").Inc()
+	metrics.MigrationFiles.WithLabelValues("failed").Inc()
+}
+
+// report returns the current progress along with the failures since the
+// previous report.
+func (p *progressTracker) report() *pb.MigrationProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	progress := &pb.MigrationProgress{
+		Stage:       p.stage,
+		FilesTotal:  int32(p.filesTotal),
+		FilesDone:   int32(p.filesDone),
+		FilesFailed: int32(p.filesFailed),
+		BytesMoved:  p.bytesMoved,
+		Errors:      p.unreportedErrors,
+	}
+	p.unreportedErrors = nil
+	elapsed := time.Since(p.stageStart)
+	if p.stage == "" || elapsed <= 0 {
+		return progress
+	}
+	progress.BytesPerSecond = float64(p.bytesMoved-p.stageStartBytes) / elapsed.Seconds()
+	processed := p.filesDone + p.filesFailed
+	if processed > 0 {
+		remaining := p.filesTotal - processed
+		progress.EtaMs = (elapsed * time.Duration(remaining) / time.Duration(processed)).Milliseconds()
+	}
+	return progress
+}
+
+// describe summarises the progress in one line.
+func (p *progressTracker) describe() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.stage {
+	case "":
+		return "waiting to start"
+	case stageCopying, stageDeleting:
+		return fmt.Sprintf("%s %d/%d files, %d failed", p.stage, p.filesDone, p.filesTotal, p.filesFailed)
+	}
+	return p.stage
+}
+
+// streamMigration runs migrate and sends its progress every progressInterval,
+// followed by a final message with the result. If the client goes away the
+// migration keeps running to completion.
+func streamMigration(send func(*pb.MigrationProgress) error, migrate func(*progressTracker) (*migrationSummary, error)) error {
+	progress := &progressTracker{}
+	var summary *migrationSummary
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		summary, err = migrate(progress)
+	}()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if sendErr := send(progress.report()); sendErr != nil {
+				return sendErr
+			}
+		case <-done:
+			if err != nil {
+				return err
+			}
+			final := progress.report()
+			if summary.completed {
+				// otherwise the stage the migration stopped in
+				final.Stage = stageDone
+			}
+			final.Finished = true
+			final.MigratedFileCount = int32(summary.migrated)
+			final.Completed = summary.completed
+			return send(final)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Anti-entropy repair: put every file back on the node the ring says owns it
+
+package coordinator
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"sync"
+	"time"
+	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	repairMove     = "move"
+	repairRestore  = "restore"
+	repairDelete   = "delete"
+	repairConflict = "conflict"
+)
+
+// Repair compares every node's files with the placement the ring expects.
+// Files found away from their owner are moved to it (or replace the owner's
+// copy if that one is corrupt), and the other copies are deleted once they
+// are confirmed identical to the owner's. Copies that differ are reported as
+// conflicts and left alone.
+func (c *Coordinator) Repair(ctx context.Context, rr *pb.RepairRequest) (*pb.RepairResponse, error) {
+	c.adminMu.Lock()
+	defer c.adminMu.Unlock()
+	return c.repair(migrationOptionsFromProto(rr.Options), rr.DryRun)
+}
+
+// StartRepairSchedule runs a repair every interval. A round is skipped while
+// another migration or repair is running.
+func (c *Coordinator) StartRepairSchedule(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stopMonitor:
+				return
+			case <-ticker.C:
+			}
+			if !c.adminMu.TryLock() {
+				slog.Info("Skipping scheduled repair: a migration is running")
+				continue
+			}
+			response, err := c.repair(defaultMigrationOptions, false)
+			c.adminMu.Unlock()
+			if err != nil {
+				slog.Error("Scheduled repair failed", "error", err)
+				continue
+			}
+			slog.Info("Scheduled repair finished", "checked", response.FilesChecked, "actions", len(response.Actions), "errors", len(response.Errors))
+		}
+	}()
+}
+
+// repair does the work of Repair. Must be called with adminMu held.
+func (c *Coordinator) repair(opts migrationOptions, dryRun bool) (*pb.RepairResponse, error) {
+	ctx := context.Background()
+	if c.pending != nil {
+		return nil, fmt.Errorf("the %s of node %s has not finished; resume it before repairing", c.pending.m.Op, c.pending.m.Node)
+	}
+	c.mu.RLock()
+	nodes := append([]node(nil), c.aliveNodes...)
+	draining := len(c.draining)
+	c.mu.RUnlock()
+	if draining > 0 {
+		return nil, errors.New("cannot repair while nodes are draining")
+	}
+	if len(nodes) == 0 {
+		return nil, ring.ErrNoNodes
+	}
+	engine := newMigrationEngine(opts)
+
+	// every node must answer: a file missing from an unlisted node could
+	// make its copies elsewhere look like strays
+	holders := make(map[string][]node)
+	for _, n := range nodes {
+		infos, err := engine.listFiles(ctx, n.client, &pb.ListRequest{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files on %s: %w", n.addr, err)
+		}
+		for _, file := range fileNames(infos) {
+			holders[file] = append(holders[file], n)
+		}
+	}
+
+	r := ring.New(0, nodeAddrs(nodes))
+	byAddr := make(map[string]node, len(nodes))
+	for _, n := range nodes {
+		byAddr[n.addr] = n
+	}
+	misplaced := make([]string, 0)
+	for file, held := range holders {
+		owner, _ := r.NodeForKey(file)
+		if len(held) > 1 || held[0].addr != owner.Addr {
+			misplaced = append(misplaced, file)
+		}
+	}
+	sort.Strings(misplaced)
+
+	response := &pb.RepairResponse{
+		Actions:      make([]*pb.RepairAction, 0),
+		FilesChecked: int32(len(holders)),
+	}
+	var mu sync.Mutex
+	response.Errors = engine.forEach(misplaced, func(file string) error {
+		owner, _ := r.NodeForKey(file)
+		actions, err := repairFile(ctx, engine, file, byAddr[owner.Addr], holders[file], dryRun)
+		mu.Lock()
+		response.Actions = append(response.Actions, actions...)
+		mu.Unlock()
+		return err
+	})
+	sort.Slice(response.Actions, func(i, j int) bool {
+		return response.Actions[i].File < response.Actions[j].File
+	})
+	return response, nil
+}
+
+// fileCopy is one node's copy of a file.
+type fileCopy struct {
+	node  node
+	sum   [sha256.Size]byte // checksum stored with it
+	valid bool              // the data still matches sum
+}
+
+// repairFile makes sure owner holds an intact copy of file and deletes the
+// copies on other nodes that are identical to it.
+func repairFile(ctx context.Context, engine *migrationEngine, file string, owner node, held []node, dryRun bool) ([]*pb.RepairAction, error) {
+	actions := make([]*pb.RepairAction, 0)
+	var ownerCopy *fileCopy
+	strays := make([]*fileCopy, 0)
+	for _, n := range held {
+		fc, err := readCopy(ctx, engine, n, file)
+		if err != nil {
+			return actions, fmt.Errorf("read from %s: %w", n.addr, err)
+		}
+		if n.addr == owner.addr {
+			ownerCopy = fc
+		} else {
+			strays = append(strays, fc)
+		}
+	}
+
+	good := ownerCopy
+	if good == nil || !good.valid {
+		for _, stray := range strays {
+			if stray.valid {
+				good = stray
+				break
+			}
+		}
+		if good == nil || !good.valid {
+			return actions, errors.New("no intact copy to restore the owner from")
+		}
+		action := &pb.RepairAction{File: file, Action: repairMove, Node: good.node.addr, Owner: owner.addr}
+		if ownerCopy != nil {
+			action.Action = repairRestore
+			action.Detail = "owner's copy does not match its checksum"
+		}
+		if !dryRun {
+			if _, err := copyAndVerify(ctx, engine, good.node.client, owner.client, file); err != nil {
+				return actions, fmt.Errorf("%s from %s to %s: %w", action.Action, good.node.addr, owner.addr, err)
+			}
+		}
+		actions = append(actions, action)
+	}
+
+	for _, stray := range strays {
+		if !stray.valid || stray.sum != good.sum {
+			actions = append(actions, &pb.RepairAction{File: file, Action: repairConflict, Node: stray.node.addr, Owner: owner.addr, Detail: "differs from the owner's copy"})
+			continue
+		}
+		if !dryRun {
+			err := engine.call(ctx, func(ctx context.Context) error {
+				_, err := stray.node.client.Remove(ctx, &pb.RemoveRequest{VideoId: path.Dir(file), FileName: path.Base(file)})
+				return err
+			})
+			if err != nil {
+				return actions, fmt.Errorf("delete duplicate from %s: %w", stray.node.addr, err)
+			}
+		}
+		actions = append(actions, &pb.RepairAction{File: file, Action: repairDelete, Node: stray.node.addr, Owner: owner.addr})
+	}
+	return actions, nil
+}
+
+// readCopy has the node re-hash its copy of file, so copies are compared
+// without transferring them.
+func readCopy(ctx context.Context, engine *migrationEngine, n node, file string) (*fileCopy, error) {
+	var resp *pb.StatResponse
+	corrupt := false
+	err := engine.call(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = n.client.Stat(ctx, &pb.StatRequest{VideoId: path.Dir(file), FileName: path.Base(file), Verify: true})
+		if status.Code(err) == codes.DataLoss {
+			// still need the stored checksum to compare with the others
+			corrupt = true
+			resp, err = n.client.Stat(ctx, &pb.StatRequest{VideoId: path.Dir(file), FileName: path.Base(file)})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	fc := &fileCopy{node: n, valid: !corrupt}
+	copy(fc.sum[:], resp.Sha256)
+	return fc, nil
+}
@@ -0,0 +1,219 @@
+// Storage node health checking over the standard gRPC health service
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	pb "tritontube/internal/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type State string
+
+const (
+	Up      State = "up"
+	Suspect State = "suspect" // the last probe failed
+	Down    State = "down"    // downAfter probes in a row failed
+)
+
+const (
+	probeInterval = 2 * time.Second
+	probeTimeout  = time.Second
+	downAfter     = 3
+)
+
+var reconnectBackoff = backoff.Config{
+	BaseDelay:  probeInterval / 4,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+	MaxDelay:   probeInterval,
+}
+
+// Checker probes a set of storage nodes every probeInterval. Nodes start out
+// up, become suspect after one failed probe and down after downAfter failed
+// probes in a row; a single successful probe brings them back up.
+type Checker struct {
+	mu        sync.RWMutex
+	targets   map[string]*target
+	onRecover func(addr string)
+	cancel    context.CancelFunc
+}
+
+type target struct {
+	conn     *grpc.ClientConn
+	client   healthpb.HealthClient
+	state    State
+	failures int
+	lastErr  error
+}
+
+func NewChecker() *Checker {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Checker{
+		targets: make(map[string]*target),
+		cancel:  cancel,
+	}
+	go c.run(ctx)
+	return c
+}
+
+// Set replaces the probed nodes with addrs.
+func (c *Checker) Set(addrs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wanted := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		wanted[addr] = true
+		if _, ok := c.targets[addr]; ok {
+			continue
+		}
+		// reconnect at least as often as we probe, so a node that comes back
+		// is seen as up by the next probe
+		conn, err := grpc.NewClient(addr,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithConnectParams(grpc.ConnectParams{Backoff: reconnectBackoff, MinConnectTimeout: probeTimeout}))
+		if err != nil {
+			slog.Error("Failed to connect to storage node for health checks", "node", addr, "error", err)
+			continue
+		}
+		c.targets[addr] = &target{conn: conn, client: healthpb.NewHealthClient(conn), state: Up}
+	}
+	for addr, t := range c.targets {
+		if !wanted[addr] {
+			t.conn.Close()
+			delete(c.targets, addr)
+		}
+	}
+}
+
+// OnRecover makes the checker call fn whenever a node that was suspect or
+// down passes a probe again.
+func (c *Checker) OnRecover(fn func(addr string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onRecover = fn
+}
+
+// State returns the state of addr. Nodes that are not probed are up.
+func (c *Checker) State(addr string) State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if t, ok := c.targets[addr]; ok {
+		return t.state
+	}
+	return Up
+}
+
+// Describe returns the state of addr and, unless it is up, why.
+func (c *Checker) Describe(addr string) (State, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.targets[addr]
+	if !ok {
+		return Up, ""
+	}
+	if t.state == Up || t.lastErr == nil {
+		return t.state, ""
+	}
+	return t.state, t.lastErr.Error()
+}
+
+// Close stops probing and closes every connection.
+func (c *Checker) Close() {
+	c.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, t := range c.targets {
+		t.conn.Close()
+		delete(c.targets, addr)
+	}
+}
+
+func (c *Checker) run(ctx context.Context) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.probeAll(ctx)
+		}
+	}
+}
+
+func (c *Checker) probeAll(ctx context.Context) {
+	c.mu.RLock()
+	targets := make(map[string]*target, len(c.targets))
+	for addr, t := range c.targets {
+		targets[addr] = t
+	}
+	c.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for addr, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := probe(ctx, t.client)
+			c.mu.Lock()
+			recovered := c.record(addr, t, err)
+			onRecover := c.onRecover
+			c.mu.Unlock()
+			if recovered && onRecover != nil {
+				onRecover(addr)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func probe(ctx context.Context, client healthpb.HealthClient) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: pb.StorageService_ServiceDesc.ServiceName})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("storage service is %s", resp.Status)
+	}
+	return nil
+}
+
+// record applies the result of one probe and reports whether it brought the
+// node back up. Must be called with mu held.
+func (c *Checker) record(addr string, t *target, err error) bool {
+	before := t.state
+	t.lastErr = err
+	if err == nil {
+		t.failures = 0
+		t.state = Up
+	} else {
+		t.failures++
+		t.state = Suspect
+		if t.failures >= downAfter {
+			t.state = Down
+		}
+	}
+	if t.state != before {
+		level := slog.LevelWarn
+		if t.state == Up {
+			level = slog.LevelInfo
+		}
+		attrs := []any{"node", addr, "state", string(t.state)}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		slog.Log(context.Background(), level, "Storage node health changed", attrs...)
+	}
+	return before != Up && t.state == Up
+}
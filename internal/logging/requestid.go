@@ -0,0 +1,158 @@
+// Passing request IDs through HTTP requests and gRPC metadata
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// RequestIDHeader carries the request ID in HTTP requests and responses.
+	RequestIDHeader = "X-Request-ID"
+	// requestIDMetadata carries the request ID in gRPC metadata.
+	requestIDMetadata = "x-request-id"
+)
+
+// Middleware gives every request an ID, taken from its X-Request-ID header
+// if the client sent a usable one, returns it in the response's X-Request-ID
+// header, and logs the request once it has been handled.
+func Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := WithRequestID(r.Context(), id)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		h.ServeHTTP(recorder, r.WithContext(ctx))
+		slog.InfoContext(ctx, "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr)
+	})
+}
+
+// statusRecorder remembers the status code and body size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// DialOptions sends the request ID of each RPC's context along with it.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(streamClientInterceptor),
+	}
+}
+
+func outgoing(ctx context.Context) context.Context {
+	if id := RequestID(ctx); id != "" {
+		return metadata.AppendToOutgoingContext(ctx, requestIDMetadata, id)
+	}
+	return ctx
+}
+
+func unaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+}
+
+func streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(outgoing(ctx), desc, cc, method, opts...)
+}
+
+// ServerOptions puts the request ID an RPC was sent with in its context,
+// and logs every RPC at debug level, or at warn level if it failed in a way
+// that points to a problem on this server.
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryServerInterceptor),
+		grpc.ChainStreamInterceptor(streamServerInterceptor),
+	}
+}
+
+func incoming(ctx context.Context) context.Context {
+	ids := metadata.ValueFromIncomingContext(ctx, requestIDMetadata)
+	if len(ids) > 0 && validRequestID(ids[0]) {
+		return WithRequestID(ctx, ids[0])
+	}
+	return ctx
+}
+
+func logRPC(ctx context.Context, method string, start time.Time, err error) {
+	if strings.HasPrefix(method, "/grpc.health.v1.") {
+		// probed every few seconds by every web server and the coordinator
+		return
+	}
+	level := slog.LevelDebug
+	switch status.Code(err) {
+	case codes.Unknown, codes.Internal, codes.DataLoss:
+		level = slog.LevelWarn
+	}
+	attrs := []any{"method", method, "code", status.Code(err).String(), "duration", time.Since(start)}
+	if err != nil {
+		attrs = append(attrs, "error", status.Convert(err).Message())
+	}
+	slog.Log(ctx, level, "RPC handled", attrs...)
+}
+
+func unaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx = incoming(ctx)
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRPC(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func streamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := incoming(ss.Context())
+	start := time.Now()
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	logRPC(ctx, info.FullMethod, start, err)
+	return err
+}
+
+// serverStream hands the stream's handler the context with its request ID.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,143 @@
+// gRPC interceptors that count and time RPCs
+
+package metrics
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rpcHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc_server",
+		Name:      "handled_total",
+		Help:      "RPCs handled, by service, method and status code.",
+	}, []string{"service", "method", "code"})
+	rpcHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc_server",
+		Name:      "handling_seconds",
+		Help:      "Time to handle an RPC, by service and method; for streams, until the stream ends.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method"})
+
+	rpcClientHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc_client",
+		Name:      "handled_total",
+		Help:      "RPCs sent to another server, by its address, method and status code.",
+	}, []string{"node", "method", "code"})
+	rpcClientSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc_client",
+		Name:      "handling_seconds",
+		Help:      "Time until an RPC to another server finished, by its address and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"node", "method"})
+)
+
+// splitMethod splits "/package.Service/Method" into the service and method.
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", fullMethod
+	}
+	return service, method
+}
+
+func observeServer(fullMethod string, start time.Time, err error) {
+	service, method := splitMethod(fullMethod)
+	rpcHandled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	rpcHandlingSeconds.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
+
+func observeClient(node string, fullMethod string, start time.Time, err error) {
+	_, method := splitMethod(fullMethod)
+	rpcClientHandled.WithLabelValues(node, method, status.Code(err).String()).Inc()
+	rpcClientSeconds.WithLabelValues(node, method).Observe(time.Since(start).Seconds())
+}
+
+// ServerOptions instruments every RPC a gRPC server handles.
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryServerInterceptor),
+		grpc.ChainStreamInterceptor(streamServerInterceptor),
+	}
+}
+
+func unaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeServer(info.FullMethod, start, err)
+	return resp, err
+}
+
+func streamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeServer(info.FullMethod, start, err)
+	return err
+}
+
+// DialOptions instruments every RPC sent over a client connection, labelled
+// with the connection's target so error rates can be told apart per node.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(streamClientInterceptor),
+	}
+}
+
+func unaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	observeClient(cc.Target(), method, start, err)
+	return err
+}
+
+func streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		observeClient(cc.Target(), method, start, err)
+		return nil, err
+	}
+	return &clientStream{ClientStream: stream, desc: desc, node: cc.Target(), method: method, start: start}, nil
+}
+
+// clientStream records a stream once its result is known: when a receive
+// fails, or for a client-streaming RPC, when its one response arrives. A
+// stream the caller abandons without receiving to the end is not recorded.
+type clientStream struct {
+	grpc.ClientStream
+	desc   *grpc.StreamDesc
+	node   string
+	method string
+	start  time.Time
+	once   sync.Once
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		s.finish(nil)
+	} else if err != nil || !s.desc.ServerStreams {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		observeClient(s.node, s.method, s.start, err)
+	})
+}
@@ -0,0 +1,115 @@
+// Prometheus metrics shared by the web, storage and coordinator servers
+
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tritontube"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by handler, method and status code.",
+	}, []string{"handler", "method", "code"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time to handle an HTTP request, by handler and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler", "method"})
+	httpResponseBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "response_size_bytes",
+		Help:      "Bytes written in HTTP responses, by handler; the sum is the bytes served.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8), // 1 KiB to 16 MiB
+	}, []string{"handler"})
+
+	transcodeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "upload",
+		Name:      "transcode_duration_seconds",
+		Help:      "Time ffmpeg took to encode an upload, successful or not.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10), // 0.5s to about 4m
+	})
+	transcodeFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "upload",
+		Name:      "transcode_failures_total",
+		Help:      "Uploads ffmpeg failed to encode.",
+	})
+
+	MigrationInProgress = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "migration",
+		Name:      "in_progress",
+		Help:      "Migrations currently running.",
+	})
+	MigrationStageFiles = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "migration",
+		Name:      "stage_files",
+		Help:      "Files in the current stage of the running migration, by state (total, done, failed).",
+	}, []string{"state"})
+	MigrationFiles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "migration",
+		Name:      "files_total",
+		Help:      "Files copied or deleted by migrations, by result (done, failed).",
+	}, []string{"result"})
+	MigrationBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "migration",
+		Name:      "bytes_moved_total",
+		Help:      "Bytes copied to their new owner by migrations.",
+	})
+)
+
+// InstrumentHandler counts and times the requests h handles under name, and
+// records the size of its responses.
+func InstrumentHandler(name string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": name}
+	h = promhttp.InstrumentHandlerResponseSize(httpResponseBytes.MustCurryWith(labels), h)
+	h = promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels), h)
+	return promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels), h)
+}
+
+// ObserveTranscode records one run of ffmpeg that took d and failed if err
+// is not nil.
+func ObserveTranscode(d time.Duration, err error) {
+	transcodeDuration.Observe(d.Seconds())
+	if err != nil {
+		transcodeFailures.Inc()
+	}
+}
+
+// Handler serves every registered metric in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve serves /metrics on addr in the background, for servers that do not
+// otherwise speak HTTP.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	go func() {
+		slog.Info("Metrics listening", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Failed to serve metrics", "addr", addr, "error", err)
+			os.Exit(1)
+		}
+	}()
+}
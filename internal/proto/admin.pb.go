@@ -21,9 +21,65 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Ownership changes in phases. Every phase change is a new ring version.
+type RingPhase int32
+
+const (
+	// steady state: nodes own every key
+	RingPhase_RING_PHASE_COMMITTED RingPhase = 0
+	// data is being copied to next_nodes: nodes still own every key, but
+	// writes also go to the owner in next_nodes and reads may fall back to it
+	RingPhase_RING_PHASE_JOINING RingPhase = 1
+	// ownership has moved to nodes while the old copies are cleaned up:
+	// reads may fall back to the owner in previous_nodes
+	RingPhase_RING_PHASE_MIGRATING RingPhase = 2
+)
+
+// Enum value maps for RingPhase.
+var (
+	RingPhase_name = map[int32]string{
+		0: "RING_PHASE_COMMITTED",
+		1: "RING_PHASE_JOINING",
+		2: "RING_PHASE_MIGRATING",
+	}
+	RingPhase_value = map[string]int32{
+		"RING_PHASE_COMMITTED": 0,
+		"RING_PHASE_JOINING":   1,
+		"RING_PHASE_MIGRATING": 2,
+	}
+)
+
+func (x RingPhase) Enum() *RingPhase {
+	p := new(RingPhase)
+	*p = x
+	return p
+}
+
+func (x RingPhase) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (RingPhase) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_admin_proto_enumTypes[0].Descriptor()
+}
+
+func (RingPhase) Type() protoreflect.EnumType {
+	return &file_proto_admin_proto_enumTypes[0]
+}
+
+func (x RingPhase) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use RingPhase.Descriptor instead.
+func (RingPhase) EnumDescriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{0}
+}
+
 type AddNodeRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	NodeAddress   string                 `protobuf:"bytes,1,opt,name=node_address,json=nodeAddress,proto3" json:"node_address,omitempty"`
+	Options       *MigrationOptions      `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -65,9 +121,19 @@ func (x *AddNodeRequest) GetNodeAddress() string {
 	return ""
 }
 
+func (x *AddNodeRequest) GetOptions() *MigrationOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
 type AddNodeResponse struct {
 	state             protoimpl.MessageState `protogen:"open.v1"`
 	MigratedFileCount int32                  `protobuf:"varint,1,opt,name=migrated_file_count,json=migratedFileCount,proto3" json:"migrated_file_count,omitempty"`
+	FailedFileCount   int32                  `protobuf:"varint,2,opt,name=failed_file_count,json=failedFileCount,proto3" json:"failed_file_count,omitempty"`
+	Errors            []*MigrationError      `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	Completed         bool                   `protobuf:"varint,4,opt,name=completed,proto3" json:"completed,omitempty"`
 	unknownFields     protoimpl.UnknownFields
 	sizeCache         protoimpl.SizeCache
 }
@@ -109,9 +175,31 @@ func (x *AddNodeResponse) GetMigratedFileCount() int32 {
 	return 0
 }
 
+func (x *AddNodeResponse) GetFailedFileCount() int32 {
+	if x != nil {
+		return x.FailedFileCount
+	}
+	return 0
+}
+
+func (x *AddNodeResponse) GetErrors() []*MigrationError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+func (x *AddNodeResponse) GetCompleted() bool {
+	if x != nil {
+		return x.Completed
+	}
+	return false
+}
+
 type RemoveNodeRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	NodeAddress   string                 `protobuf:"bytes,1,opt,name=node_address,json=nodeAddress,proto3" json:"node_address,omitempty"`
+	Options       *MigrationOptions      `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -153,9 +241,19 @@ func (x *RemoveNodeRequest) GetNodeAddress() string {
 	return ""
 }
 
+func (x *RemoveNodeRequest) GetOptions() *MigrationOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
 type RemoveNodeResponse struct {
 	state             protoimpl.MessageState `protogen:"open.v1"`
 	MigratedFileCount int32                  `protobuf:"varint,1,opt,name=migrated_file_count,json=migratedFileCount,proto3" json:"migrated_file_count,omitempty"`
+	FailedFileCount   int32                  `protobuf:"varint,2,opt,name=failed_file_count,json=failedFileCount,proto3" json:"failed_file_count,omitempty"`
+	Errors            []*MigrationError      `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	Completed         bool                   `protobuf:"varint,4,opt,name=completed,proto3" json:"completed,omitempty"`
 	unknownFields     protoimpl.UnknownFields
 	sizeCache         protoimpl.SizeCache
 }
@@ -197,26 +295,54 @@ func (x *RemoveNodeResponse) GetMigratedFileCount() int32 {
 	return 0
 }
 
-type ListNodesRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *RemoveNodeResponse) GetFailedFileCount() int32 {
+	if x != nil {
+		return x.FailedFileCount
+	}
+	return 0
 }
 
-func (x *ListNodesRequest) Reset() {
-	*x = ListNodesRequest{}
+func (x *RemoveNodeResponse) GetErrors() []*MigrationError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+func (x *RemoveNodeResponse) GetCompleted() bool {
+	if x != nil {
+		return x.Completed
+	}
+	return false
+}
+
+// Tuning for one migration. Zero or unset values use the coordinator's
+// defaults; retries and backoff can be set to 0, so they are only used if set.
+type MigrationOptions struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Concurrency    int32                  `protobuf:"varint,1,opt,name=concurrency,proto3" json:"concurrency,omitempty"`
+	BytesPerSecond int64                  `protobuf:"varint,2,opt,name=bytes_per_second,json=bytesPerSecond,proto3" json:"bytes_per_second,omitempty"`
+	RpcTimeoutMs   int64                  `protobuf:"varint,3,opt,name=rpc_timeout_ms,json=rpcTimeoutMs,proto3" json:"rpc_timeout_ms,omitempty"`
+	MaxRetries     *int32                 `protobuf:"varint,4,opt,name=max_retries,json=maxRetries,proto3,oneof" json:"max_retries,omitempty"`
+	RetryBackoffMs *int64                 `protobuf:"varint,5,opt,name=retry_backoff_ms,json=retryBackoffMs,proto3,oneof" json:"retry_backoff_ms,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *MigrationOptions) Reset() {
+	*x = MigrationOptions{}
 	mi := &file_proto_admin_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ListNodesRequest) String() string {
+func (x *MigrationOptions) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListNodesRequest) ProtoMessage() {}
+func (*MigrationOptions) ProtoMessage() {}
 
-func (x *ListNodesRequest) ProtoReflect() protoreflect.Message {
+func (x *MigrationOptions) ProtoReflect() protoreflect.Message {
 	mi := &file_proto_admin_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -228,32 +354,68 @@ func (x *ListNodesRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListNodesRequest.ProtoReflect.Descriptor instead.
-func (*ListNodesRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use MigrationOptions.ProtoReflect.Descriptor instead.
+func (*MigrationOptions) Descriptor() ([]byte, []int) {
 	return file_proto_admin_proto_rawDescGZIP(), []int{4}
 }
 
-type ListNodesResponse struct {
+func (x *MigrationOptions) GetConcurrency() int32 {
+	if x != nil {
+		return x.Concurrency
+	}
+	return 0
+}
+
+func (x *MigrationOptions) GetBytesPerSecond() int64 {
+	if x != nil {
+		return x.BytesPerSecond
+	}
+	return 0
+}
+
+func (x *MigrationOptions) GetRpcTimeoutMs() int64 {
+	if x != nil {
+		return x.RpcTimeoutMs
+	}
+	return 0
+}
+
+func (x *MigrationOptions) GetMaxRetries() int32 {
+	if x != nil && x.MaxRetries != nil {
+		return *x.MaxRetries
+	}
+	return 0
+}
+
+func (x *MigrationOptions) GetRetryBackoffMs() int64 {
+	if x != nil && x.RetryBackoffMs != nil {
+		return *x.RetryBackoffMs
+	}
+	return 0
+}
+
+type MigrationError struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Nodes         []string               `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	File          string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ListNodesResponse) Reset() {
-	*x = ListNodesResponse{}
+func (x *MigrationError) Reset() {
+	*x = MigrationError{}
 	mi := &file_proto_admin_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ListNodesResponse) String() string {
+func (x *MigrationError) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListNodesResponse) ProtoMessage() {}
+func (*MigrationError) ProtoMessage() {}
 
-func (x *ListNodesResponse) ProtoReflect() protoreflect.Message {
+func (x *MigrationError) ProtoReflect() protoreflect.Message {
 	mi := &file_proto_admin_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -265,40 +427,1208 @@ func (x *ListNodesResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListNodesResponse.ProtoReflect.Descriptor instead.
-func (*ListNodesResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use MigrationError.ProtoReflect.Descriptor instead.
+func (*MigrationError) Descriptor() ([]byte, []int) {
 	return file_proto_admin_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *ListNodesResponse) GetNodes() []string {
+func (x *MigrationError) GetFile() string {
 	if x != nil {
-		return x.Nodes
+		return x.File
+	}
+	return ""
+}
+
+func (x *MigrationError) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Sent periodically while an AddNodeStream/RemoveNodeStream migration runs.
+// The last message has finished set and carries the result.
+type MigrationProgress struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Stage          string                 `protobuf:"bytes,1,opt,name=stage,proto3" json:"stage,omitempty"`
+	FilesTotal     int32                  `protobuf:"varint,2,opt,name=files_total,json=filesTotal,proto3" json:"files_total,omitempty"`
+	FilesDone      int32                  `protobuf:"varint,3,opt,name=files_done,json=filesDone,proto3" json:"files_done,omitempty"`
+	FilesFailed    int32                  `protobuf:"varint,4,opt,name=files_failed,json=filesFailed,proto3" json:"files_failed,omitempty"`
+	BytesMoved     int64                  `protobuf:"varint,5,opt,name=bytes_moved,json=bytesMoved,proto3" json:"bytes_moved,omitempty"`
+	BytesPerSecond float64                `protobuf:"fixed64,6,opt,name=bytes_per_second,json=bytesPerSecond,proto3" json:"bytes_per_second,omitempty"`
+	EtaMs          int64                  `protobuf:"varint,7,opt,name=eta_ms,json=etaMs,proto3" json:"eta_ms,omitempty"`
+	// failures since the previous message
+	Errors            []*MigrationError `protobuf:"bytes,8,rep,name=errors,proto3" json:"errors,omitempty"`
+	Finished          bool              `protobuf:"varint,9,opt,name=finished,proto3" json:"finished,omitempty"`
+	MigratedFileCount int32             `protobuf:"varint,10,opt,name=migrated_file_count,json=migratedFileCount,proto3" json:"migrated_file_count,omitempty"`
+	Completed         bool              `protobuf:"varint,11,opt,name=completed,proto3" json:"completed,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *MigrationProgress) Reset() {
+	*x = MigrationProgress{}
+	mi := &file_proto_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MigrationProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MigrationProgress) ProtoMessage() {}
+
+func (x *MigrationProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MigrationProgress.ProtoReflect.Descriptor instead.
+func (*MigrationProgress) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *MigrationProgress) GetStage() string {
+	if x != nil {
+		return x.Stage
+	}
+	return ""
+}
+
+func (x *MigrationProgress) GetFilesTotal() int32 {
+	if x != nil {
+		return x.FilesTotal
+	}
+	return 0
+}
+
+func (x *MigrationProgress) GetFilesDone() int32 {
+	if x != nil {
+		return x.FilesDone
+	}
+	return 0
+}
+
+func (x *MigrationProgress) GetFilesFailed() int32 {
+	if x != nil {
+		return x.FilesFailed
+	}
+	return 0
+}
+
+func (x *MigrationProgress) GetBytesMoved() int64 {
+	if x != nil {
+		return x.BytesMoved
+	}
+	return 0
+}
+
+func (x *MigrationProgress) GetBytesPerSecond() float64 {
+	if x != nil {
+		return x.BytesPerSecond
+	}
+	return 0
+}
+
+func (x *MigrationProgress) GetEtaMs() int64 {
+	if x != nil {
+		return x.EtaMs
+	}
+	return 0
+}
+
+func (x *MigrationProgress) GetErrors() []*MigrationError {
+	if x != nil {
+		return x.Errors
 	}
 	return nil
 }
 
-var File_proto_admin_proto protoreflect.FileDescriptor
+func (x *MigrationProgress) GetFinished() bool {
+	if x != nil {
+		return x.Finished
+	}
+	return false
+}
 
-const file_proto_admin_proto_rawDesc = "" +
-	"\n" +
-	"\x11proto/admin.proto\x12\n" +
-	"tritontube\"3\n" +
-	"\x0eAddNodeRequest\x12!\n" +
-	"\fnode_address\x18\x01 \x01(\tR\vnodeAddress\"A\n" +
-	"\x0fAddNodeResponse\x12.\n" +
-	"\x13migrated_file_count\x18\x01 \x01(\x05R\x11migratedFileCount\"6\n" +
-	"\x11RemoveNodeRequest\x12!\n" +
-	"\fnode_address\x18\x01 \x01(\tR\vnodeAddress\"D\n" +
-	"\x12RemoveNodeResponse\x12.\n" +
-	"\x13migrated_file_count\x18\x01 \x01(\x05R\x11migratedFileCount\"\x12\n" +
-	"\x10ListNodesRequest\")\n" +
-	"\x11ListNodesResponse\x12\x14\n" +
-	"\x05nodes\x18\x01 \x03(\tR\x05nodes2\xf5\x01\n" +
+func (x *MigrationProgress) GetMigratedFileCount() int32 {
+	if x != nil {
+		return x.MigratedFileCount
+	}
+	return 0
+}
+
+func (x *MigrationProgress) GetCompleted() bool {
+	if x != nil {
+		return x.Completed
+	}
+	return false
+}
+
+// What an AddNode/RemoveNode would move, computed without changing anything.
+type MigrationPlan struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Moves         []*PlannedMove         `protobuf:"bytes,1,rep,name=moves,proto3" json:"moves,omitempty"`
+	TotalFiles    int32                  `protobuf:"varint,2,opt,name=total_files,json=totalFiles,proto3" json:"total_files,omitempty"`
+	TotalBytes    int64                  `protobuf:"varint,3,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MigrationPlan) Reset() {
+	*x = MigrationPlan{}
+	mi := &file_proto_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MigrationPlan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MigrationPlan) ProtoMessage() {}
+
+func (x *MigrationPlan) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MigrationPlan.ProtoReflect.Descriptor instead.
+func (*MigrationPlan) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *MigrationPlan) GetMoves() []*PlannedMove {
+	if x != nil {
+		return x.Moves
+	}
+	return nil
+}
+
+func (x *MigrationPlan) GetTotalFiles() int32 {
+	if x != nil {
+		return x.TotalFiles
+	}
+	return 0
+}
+
+func (x *MigrationPlan) GetTotalBytes() int64 {
+	if x != nil {
+		return x.TotalBytes
+	}
+	return 0
+}
+
+type PlannedMove struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Src           string                 `protobuf:"bytes,1,opt,name=src,proto3" json:"src,omitempty"`
+	Dst           string                 `protobuf:"bytes,2,opt,name=dst,proto3" json:"dst,omitempty"`
+	Files         []string               `protobuf:"bytes,3,rep,name=files,proto3" json:"files,omitempty"`
+	Bytes         int64                  `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlannedMove) Reset() {
+	*x = PlannedMove{}
+	mi := &file_proto_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlannedMove) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlannedMove) ProtoMessage() {}
+
+func (x *PlannedMove) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlannedMove.ProtoReflect.Descriptor instead.
+func (*PlannedMove) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PlannedMove) GetSrc() string {
+	if x != nil {
+		return x.Src
+	}
+	return ""
+}
+
+func (x *PlannedMove) GetDst() string {
+	if x != nil {
+		return x.Dst
+	}
+	return ""
+}
+
+func (x *PlannedMove) GetFiles() []string {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *PlannedMove) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type DrainNodeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeAddress   string                 `protobuf:"bytes,1,opt,name=node_address,json=nodeAddress,proto3" json:"node_address,omitempty"`
+	Options       *MigrationOptions      `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainNodeRequest) Reset() {
+	*x = DrainNodeRequest{}
+	mi := &file_proto_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainNodeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainNodeRequest) ProtoMessage() {}
+
+func (x *DrainNodeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainNodeRequest.ProtoReflect.Descriptor instead.
+func (*DrainNodeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DrainNodeRequest) GetNodeAddress() string {
+	if x != nil {
+		return x.NodeAddress
+	}
+	return ""
+}
+
+func (x *DrainNodeRequest) GetOptions() *MigrationOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type DrainNodeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainNodeResponse) Reset() {
+	*x = DrainNodeResponse{}
+	mi := &file_proto_admin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainNodeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainNodeResponse) ProtoMessage() {}
+
+func (x *DrainNodeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainNodeResponse.ProtoReflect.Descriptor instead.
+func (*DrainNodeResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{10}
+}
+
+type ListNodesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNodesRequest) Reset() {
+	*x = ListNodesRequest{}
+	mi := &file_proto_admin_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNodesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNodesRequest) ProtoMessage() {}
+
+func (x *ListNodesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNodesRequest.ProtoReflect.Descriptor instead.
+func (*ListNodesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{11}
+}
+
+type ListNodesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Nodes []string               `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	// one entry per node above, in the same order
+	Statuses      []*NodeStatus `protobuf:"bytes,2,rep,name=statuses,proto3" json:"statuses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListNodesResponse) Reset() {
+	*x = ListNodesResponse{}
+	mi := &file_proto_admin_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListNodesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListNodesResponse) ProtoMessage() {}
+
+func (x *ListNodesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListNodesResponse.ProtoReflect.Descriptor instead.
+func (*ListNodesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListNodesResponse) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *ListNodesResponse) GetStatuses() []*NodeStatus {
+	if x != nil {
+		return x.Statuses
+	}
+	return nil
+}
+
+type NodeStatus struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Address string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// "active", "draining" or "drain failed"
+	State string `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	// progress of a drain, or why it failed
+	Detail string `protobuf:"bytes,3,opt,name=detail,proto3" json:"detail,omitempty"`
+	// "up", "suspect" or "down", from the coordinator's health checks
+	Health string `protobuf:"bytes,4,opt,name=health,proto3" json:"health,omitempty"`
+	// why the last health check failed
+	HealthDetail string `protobuf:"bytes,5,opt,name=health_detail,json=healthDetail,proto3" json:"health_detail,omitempty"`
+	// set for nodes that registered themselves
+	Registered         bool  `protobuf:"varint,6,opt,name=registered,proto3" json:"registered,omitempty"`
+	CapacityBytes      int64 `protobuf:"varint,7,opt,name=capacity_bytes,json=capacityBytes,proto3" json:"capacity_bytes,omitempty"`
+	LastHeartbeatMsAgo int64 `protobuf:"varint,8,opt,name=last_heartbeat_ms_ago,json=lastHeartbeatMsAgo,proto3" json:"last_heartbeat_ms_ago,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *NodeStatus) Reset() {
+	*x = NodeStatus{}
+	mi := &file_proto_admin_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NodeStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeStatus) ProtoMessage() {}
+
+func (x *NodeStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeStatus.ProtoReflect.Descriptor instead.
+func (*NodeStatus) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *NodeStatus) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *NodeStatus) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *NodeStatus) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+func (x *NodeStatus) GetHealth() string {
+	if x != nil {
+		return x.Health
+	}
+	return ""
+}
+
+func (x *NodeStatus) GetHealthDetail() string {
+	if x != nil {
+		return x.HealthDetail
+	}
+	return ""
+}
+
+func (x *NodeStatus) GetRegistered() bool {
+	if x != nil {
+		return x.Registered
+	}
+	return false
+}
+
+func (x *NodeStatus) GetCapacityBytes() int64 {
+	if x != nil {
+		return x.CapacityBytes
+	}
+	return 0
+}
+
+func (x *NodeStatus) GetLastHeartbeatMsAgo() int64 {
+	if x != nil {
+		return x.LastHeartbeatMsAgo
+	}
+	return 0
+}
+
+type RepairRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// only report what would be done
+	DryRun        bool              `protobuf:"varint,1,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	Options       *MigrationOptions `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RepairRequest) Reset() {
+	*x = RepairRequest{}
+	mi := &file_proto_admin_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RepairRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RepairRequest) ProtoMessage() {}
+
+func (x *RepairRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RepairRequest.ProtoReflect.Descriptor instead.
+func (*RepairRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RepairRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *RepairRequest) GetOptions() *MigrationOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type RepairResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Actions       []*RepairAction        `protobuf:"bytes,1,rep,name=actions,proto3" json:"actions,omitempty"`
+	Errors        []*MigrationError      `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"`
+	FilesChecked  int32                  `protobuf:"varint,3,opt,name=files_checked,json=filesChecked,proto3" json:"files_checked,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RepairResponse) Reset() {
+	*x = RepairResponse{}
+	mi := &file_proto_admin_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RepairResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RepairResponse) ProtoMessage() {}
+
+func (x *RepairResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RepairResponse.ProtoReflect.Descriptor instead.
+func (*RepairResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *RepairResponse) GetActions() []*RepairAction {
+	if x != nil {
+		return x.Actions
+	}
+	return nil
+}
+
+func (x *RepairResponse) GetErrors() []*MigrationError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+func (x *RepairResponse) GetFilesChecked() int32 {
+	if x != nil {
+		return x.FilesChecked
+	}
+	return 0
+}
+
+// One step of a repair: a file moved to its owner ("move"), a corrupt copy on
+// the owner replaced ("restore"), a duplicate deleted ("delete"), or a copy
+// that differs from the owner's and was left alone ("conflict").
+type RepairAction struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	File   string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	Action string                 `protobuf:"bytes,2,opt,name=action,proto3" json:"action,omitempty"`
+	Node   string                 `protobuf:"bytes,3,opt,name=node,proto3" json:"node,omitempty"`
+	// the owner the file was moved or restored to
+	Owner         string `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	Detail        string `protobuf:"bytes,5,opt,name=detail,proto3" json:"detail,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RepairAction) Reset() {
+	*x = RepairAction{}
+	mi := &file_proto_admin_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RepairAction) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RepairAction) ProtoMessage() {}
+
+func (x *RepairAction) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RepairAction.ProtoReflect.Descriptor instead.
+func (*RepairAction) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *RepairAction) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *RepairAction) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *RepairAction) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *RepairAction) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *RepairAction) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+type WatchRingRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the ring version the watcher now routes requests with
+	AppliedVersion uint64 `protobuf:"varint,1,opt,name=applied_version,json=appliedVersion,proto3" json:"applied_version,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *WatchRingRequest) Reset() {
+	*x = WatchRingRequest{}
+	mi := &file_proto_admin_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRingRequest) ProtoMessage() {}
+
+func (x *WatchRingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRingRequest.ProtoReflect.Descriptor instead.
+func (*WatchRingRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *WatchRingRequest) GetAppliedVersion() uint64 {
+	if x != nil {
+		return x.AppliedVersion
+	}
+	return 0
+}
+
+type RingUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       uint64                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Nodes         []string               `protobuf:"bytes,2,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	Phase         RingPhase              `protobuf:"varint,3,opt,name=phase,proto3,enum=tritontube.RingPhase" json:"phase,omitempty"`
+	NextNodes     []string               `protobuf:"bytes,4,rep,name=next_nodes,json=nextNodes,proto3" json:"next_nodes,omitempty"`
+	PreviousNodes []string               `protobuf:"bytes,5,rep,name=previous_nodes,json=previousNodes,proto3" json:"previous_nodes,omitempty"`
+	// nodes being drained: they take no new writes
+	DrainingNodes []string `protobuf:"bytes,6,rep,name=draining_nodes,json=drainingNodes,proto3" json:"draining_nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RingUpdate) Reset() {
+	*x = RingUpdate{}
+	mi := &file_proto_admin_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RingUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RingUpdate) ProtoMessage() {}
+
+func (x *RingUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RingUpdate.ProtoReflect.Descriptor instead.
+func (*RingUpdate) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *RingUpdate) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *RingUpdate) GetNodes() []string {
+	if x != nil {
+		return x.Nodes
+	}
+	return nil
+}
+
+func (x *RingUpdate) GetPhase() RingPhase {
+	if x != nil {
+		return x.Phase
+	}
+	return RingPhase_RING_PHASE_COMMITTED
+}
+
+func (x *RingUpdate) GetNextNodes() []string {
+	if x != nil {
+		return x.NextNodes
+	}
+	return nil
+}
+
+func (x *RingUpdate) GetPreviousNodes() []string {
+	if x != nil {
+		return x.PreviousNodes
+	}
+	return nil
+}
+
+func (x *RingUpdate) GetDrainingNodes() []string {
+	if x != nil {
+		return x.DrainingNodes
+	}
+	return nil
+}
+
+type RegisterRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// address other components use to reach the node
+	NodeAddress string `protobuf:"bytes,1,opt,name=node_address,json=nodeAddress,proto3" json:"node_address,omitempty"`
+	// storage the node offers, 0 if unknown
+	CapacityBytes int64 `protobuf:"varint,2,opt,name=capacity_bytes,json=capacityBytes,proto3" json:"capacity_bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterRequest) Reset() {
+	*x = RegisterRequest{}
+	mi := &file_proto_admin_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterRequest) ProtoMessage() {}
+
+func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterRequest.ProtoReflect.Descriptor instead.
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RegisterRequest) GetNodeAddress() string {
+	if x != nil {
+		return x.NodeAddress
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetCapacityBytes() int64 {
+	if x != nil {
+		return x.CapacityBytes
+	}
+	return 0
+}
+
+type RegisterResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// how often the node must send heartbeats
+	HeartbeatIntervalMs int64 `protobuf:"varint,1,opt,name=heartbeat_interval_ms,json=heartbeatIntervalMs,proto3" json:"heartbeat_interval_ms,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *RegisterResponse) Reset() {
+	*x = RegisterResponse{}
+	mi := &file_proto_admin_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResponse) ProtoMessage() {}
+
+func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *RegisterResponse) GetHeartbeatIntervalMs() int64 {
+	if x != nil {
+		return x.HeartbeatIntervalMs
+	}
+	return 0
+}
+
+type HeartbeatRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeAddress   string                 `protobuf:"bytes,1,opt,name=node_address,json=nodeAddress,proto3" json:"node_address,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_proto_admin_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *HeartbeatRequest) GetNodeAddress() string {
+	if x != nil {
+		return x.NodeAddress
+	}
+	return ""
+}
+
+type HeartbeatResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// false if the coordinator does not know the node, which must register again
+	Registered    bool `protobuf:"varint,1,opt,name=registered,proto3" json:"registered,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResponse) Reset() {
+	*x = HeartbeatResponse{}
+	mi := &file_proto_admin_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResponse) ProtoMessage() {}
+
+func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
+func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *HeartbeatResponse) GetRegistered() bool {
+	if x != nil {
+		return x.Registered
+	}
+	return false
+}
+
+var File_proto_admin_proto protoreflect.FileDescriptor
+
+const file_proto_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x11proto/admin.proto\x12\n" +
+	"tritontube\"k\n" +
+	"\x0eAddNodeRequest\x12!\n" +
+	"\fnode_address\x18\x01 \x01(\tR\vnodeAddress\x126\n" +
+	"\aoptions\x18\x02 \x01(\v2\x1c.tritontube.MigrationOptionsR\aoptions\"\xbf\x01\n" +
+	"\x0fAddNodeResponse\x12.\n" +
+	"\x13migrated_file_count\x18\x01 \x01(\x05R\x11migratedFileCount\x12*\n" +
+	"\x11failed_file_count\x18\x02 \x01(\x05R\x0ffailedFileCount\x122\n" +
+	"\x06errors\x18\x03 \x03(\v2\x1a.tritontube.MigrationErrorR\x06errors\x12\x1c\n" +
+	"\tcompleted\x18\x04 \x01(\bR\tcompleted\"n\n" +
+	"\x11RemoveNodeRequest\x12!\n" +
+	"\fnode_address\x18\x01 \x01(\tR\vnodeAddress\x126\n" +
+	"\aoptions\x18\x02 \x01(\v2\x1c.tritontube.MigrationOptionsR\aoptions\"\xc2\x01\n" +
+	"\x12RemoveNodeResponse\x12.\n" +
+	"\x13migrated_file_count\x18\x01 \x01(\x05R\x11migratedFileCount\x12*\n" +
+	"\x11failed_file_count\x18\x02 \x01(\x05R\x0ffailedFileCount\x122\n" +
+	"\x06errors\x18\x03 \x03(\v2\x1a.tritontube.MigrationErrorR\x06errors\x12\x1c\n" +
+	"\tcompleted\x18\x04 \x01(\bR\tcompleted\"\xfe\x01\n" +
+	"\x10MigrationOptions\x12 \n" +
+	"\vconcurrency\x18\x01 \x01(\x05R\vconcurrency\x12(\n" +
+	"\x10bytes_per_second\x18\x02 \x01(\x03R\x0ebytesPerSecond\x12$\n" +
+	"\x0erpc_timeout_ms\x18\x03 \x01(\x03R\frpcTimeoutMs\x12$\n" +
+	"\vmax_retries\x18\x04 \x01(\x05H\x00R\n" +
+	"maxRetries\x88\x01\x01\x12-\n" +
+	"\x10retry_backoff_ms\x18\x05 \x01(\x03H\x01R\x0eretryBackoffMs\x88\x01\x01B\x0e\n" +
+	"\f_max_retriesB\x13\n" +
+	"\x11_retry_backoff_ms\":\n" +
+	"\x0eMigrationError\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x8c\x03\n" +
+	"\x11MigrationProgress\x12\x14\n" +
+	"\x05stage\x18\x01 \x01(\tR\x05stage\x12\x1f\n" +
+	"\vfiles_total\x18\x02 \x01(\x05R\n" +
+	"filesTotal\x12\x1d\n" +
+	"\n" +
+	"files_done\x18\x03 \x01(\x05R\tfilesDone\x12!\n" +
+	"\ffiles_failed\x18\x04 \x01(\x05R\vfilesFailed\x12\x1f\n" +
+	"\vbytes_moved\x18\x05 \x01(\x03R\n" +
+	"bytesMoved\x12(\n" +
+	"\x10bytes_per_second\x18\x06 \x01(\x01R\x0ebytesPerSecond\x12\x15\n" +
+	"\x06eta_ms\x18\a \x01(\x03R\x05etaMs\x122\n" +
+	"\x06errors\x18\b \x03(\v2\x1a.tritontube.MigrationErrorR\x06errors\x12\x1a\n" +
+	"\bfinished\x18\t \x01(\bR\bfinished\x12.\n" +
+	"\x13migrated_file_count\x18\n" +
+	" \x01(\x05R\x11migratedFileCount\x12\x1c\n" +
+	"\tcompleted\x18\v \x01(\bR\tcompleted\"\x80\x01\n" +
+	"\rMigrationPlan\x12-\n" +
+	"\x05moves\x18\x01 \x03(\v2\x17.tritontube.PlannedMoveR\x05moves\x12\x1f\n" +
+	"\vtotal_files\x18\x02 \x01(\x05R\n" +
+	"totalFiles\x12\x1f\n" +
+	"\vtotal_bytes\x18\x03 \x01(\x03R\n" +
+	"totalBytes\"]\n" +
+	"\vPlannedMove\x12\x10\n" +
+	"\x03src\x18\x01 \x01(\tR\x03src\x12\x10\n" +
+	"\x03dst\x18\x02 \x01(\tR\x03dst\x12\x14\n" +
+	"\x05files\x18\x03 \x03(\tR\x05files\x12\x14\n" +
+	"\x05bytes\x18\x04 \x01(\x03R\x05bytes\"m\n" +
+	"\x10DrainNodeRequest\x12!\n" +
+	"\fnode_address\x18\x01 \x01(\tR\vnodeAddress\x126\n" +
+	"\aoptions\x18\x02 \x01(\v2\x1c.tritontube.MigrationOptionsR\aoptions\"\x13\n" +
+	"\x11DrainNodeResponse\"\x12\n" +
+	"\x10ListNodesRequest\"]\n" +
+	"\x11ListNodesResponse\x12\x14\n" +
+	"\x05nodes\x18\x01 \x03(\tR\x05nodes\x122\n" +
+	"\bstatuses\x18\x02 \x03(\v2\x16.tritontube.NodeStatusR\bstatuses\"\x8b\x02\n" +
+	"\n" +
+	"NodeStatus\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\tR\x05state\x12\x16\n" +
+	"\x06detail\x18\x03 \x01(\tR\x06detail\x12\x16\n" +
+	"\x06health\x18\x04 \x01(\tR\x06health\x12#\n" +
+	"\rhealth_detail\x18\x05 \x01(\tR\fhealthDetail\x12\x1e\n" +
+	"\n" +
+	"registered\x18\x06 \x01(\bR\n" +
+	"registered\x12%\n" +
+	"\x0ecapacity_bytes\x18\a \x01(\x03R\rcapacityBytes\x121\n" +
+	"\x15last_heartbeat_ms_ago\x18\b \x01(\x03R\x12lastHeartbeatMsAgo\"`\n" +
+	"\rRepairRequest\x12\x17\n" +
+	"\adry_run\x18\x01 \x01(\bR\x06dryRun\x126\n" +
+	"\aoptions\x18\x02 \x01(\v2\x1c.tritontube.MigrationOptionsR\aoptions\"\x9d\x01\n" +
+	"\x0eRepairResponse\x122\n" +
+	"\aactions\x18\x01 \x03(\v2\x18.tritontube.RepairActionR\aactions\x122\n" +
+	"\x06errors\x18\x02 \x03(\v2\x1a.tritontube.MigrationErrorR\x06errors\x12#\n" +
+	"\rfiles_checked\x18\x03 \x01(\x05R\ffilesChecked\"|\n" +
+	"\fRepairAction\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x16\n" +
+	"\x06action\x18\x02 \x01(\tR\x06action\x12\x12\n" +
+	"\x04node\x18\x03 \x01(\tR\x04node\x12\x14\n" +
+	"\x05owner\x18\x04 \x01(\tR\x05owner\x12\x16\n" +
+	"\x06detail\x18\x05 \x01(\tR\x06detail\";\n" +
+	"\x10WatchRingRequest\x12'\n" +
+	"\x0fapplied_version\x18\x01 \x01(\x04R\x0eappliedVersion\"\xd6\x01\n" +
+	"\n" +
+	"RingUpdate\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\x04R\aversion\x12\x14\n" +
+	"\x05nodes\x18\x02 \x03(\tR\x05nodes\x12+\n" +
+	"\x05phase\x18\x03 \x01(\x0e2\x15.tritontube.RingPhaseR\x05phase\x12\x1d\n" +
+	"\n" +
+	"next_nodes\x18\x04 \x03(\tR\tnextNodes\x12%\n" +
+	"\x0eprevious_nodes\x18\x05 \x03(\tR\rpreviousNodes\x12%\n" +
+	"\x0edraining_nodes\x18\x06 \x03(\tR\rdrainingNodes\"[\n" +
+	"\x0fRegisterRequest\x12!\n" +
+	"\fnode_address\x18\x01 \x01(\tR\vnodeAddress\x12%\n" +
+	"\x0ecapacity_bytes\x18\x02 \x01(\x03R\rcapacityBytes\"F\n" +
+	"\x10RegisterResponse\x122\n" +
+	"\x15heartbeat_interval_ms\x18\x01 \x01(\x03R\x13heartbeatIntervalMs\"5\n" +
+	"\x10HeartbeatRequest\x12!\n" +
+	"\fnode_address\x18\x01 \x01(\tR\vnodeAddress\"3\n" +
+	"\x11HeartbeatResponse\x12\x1e\n" +
+	"\n" +
+	"registered\x18\x01 \x01(\bR\n" +
+	"registered*W\n" +
+	"\tRingPhase\x12\x18\n" +
+	"\x14RING_PHASE_COMMITTED\x10\x00\x12\x16\n" +
+	"\x12RING_PHASE_JOINING\x10\x01\x12\x18\n" +
+	"\x14RING_PHASE_MIGRATING\x10\x022\x8c\a\n" +
 	"\x18VideoContentAdminService\x12B\n" +
 	"\aAddNode\x12\x1a.tritontube.AddNodeRequest\x1a\x1b.tritontube.AddNodeResponse\x12K\n" +
 	"\n" +
-	"RemoveNode\x12\x1d.tritontube.RemoveNodeRequest\x1a\x1e.tritontube.RemoveNodeResponse\x12H\n" +
-	"\tListNodes\x12\x1c.tritontube.ListNodesRequest\x1a\x1d.tritontube.ListNodesResponseB\x16Z\x14internal/proto;protob\x06proto3"
+	"RemoveNode\x12\x1d.tritontube.RemoveNodeRequest\x1a\x1e.tritontube.RemoveNodeResponse\x12L\n" +
+	"\rAddNodeStream\x12\x1a.tritontube.AddNodeRequest\x1a\x1d.tritontube.MigrationProgress0\x01\x12R\n" +
+	"\x10RemoveNodeStream\x12\x1d.tritontube.RemoveNodeRequest\x1a\x1d.tritontube.MigrationProgress0\x01\x12H\n" +
+	"\tListNodes\x12\x1c.tritontube.ListNodesRequest\x1a\x1d.tritontube.ListNodesResponse\x12H\n" +
+	"\tDrainNode\x12\x1c.tritontube.DrainNodeRequest\x1a\x1d.tritontube.DrainNodeResponse\x12D\n" +
+	"\vPlanAddNode\x12\x1a.tritontube.AddNodeRequest\x1a\x19.tritontube.MigrationPlan\x12J\n" +
+	"\x0ePlanRemoveNode\x12\x1d.tritontube.RemoveNodeRequest\x1a\x19.tritontube.MigrationPlan\x12?\n" +
+	"\x06Repair\x12\x19.tritontube.RepairRequest\x1a\x1a.tritontube.RepairResponse\x12E\n" +
+	"\tWatchRing\x12\x1c.tritontube.WatchRingRequest\x1a\x16.tritontube.RingUpdate(\x010\x01\x12E\n" +
+	"\bRegister\x12\x1b.tritontube.RegisterRequest\x1a\x1c.tritontube.RegisterResponse\x12H\n" +
+	"\tHeartbeat\x12\x1c.tritontube.HeartbeatRequest\x1a\x1d.tritontube.HeartbeatResponseB\x16Z\x14internal/proto;protob\x06proto3"
 
 var (
 	file_proto_admin_proto_rawDescOnce sync.Once
@@ -312,27 +1642,76 @@ func file_proto_admin_proto_rawDescGZIP() []byte {
 	return file_proto_admin_proto_rawDescData
 }
 
-var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_proto_admin_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 23)
 var file_proto_admin_proto_goTypes = []any{
-	(*AddNodeRequest)(nil),     // 0: tritontube.AddNodeRequest
-	(*AddNodeResponse)(nil),    // 1: tritontube.AddNodeResponse
-	(*RemoveNodeRequest)(nil),  // 2: tritontube.RemoveNodeRequest
-	(*RemoveNodeResponse)(nil), // 3: tritontube.RemoveNodeResponse
-	(*ListNodesRequest)(nil),   // 4: tritontube.ListNodesRequest
-	(*ListNodesResponse)(nil),  // 5: tritontube.ListNodesResponse
+	(RingPhase)(0),             // 0: tritontube.RingPhase
+	(*AddNodeRequest)(nil),     // 1: tritontube.AddNodeRequest
+	(*AddNodeResponse)(nil),    // 2: tritontube.AddNodeResponse
+	(*RemoveNodeRequest)(nil),  // 3: tritontube.RemoveNodeRequest
+	(*RemoveNodeResponse)(nil), // 4: tritontube.RemoveNodeResponse
+	(*MigrationOptions)(nil),   // 5: tritontube.MigrationOptions
+	(*MigrationError)(nil),     // 6: tritontube.MigrationError
+	(*MigrationProgress)(nil),  // 7: tritontube.MigrationProgress
+	(*MigrationPlan)(nil),      // 8: tritontube.MigrationPlan
+	(*PlannedMove)(nil),        // 9: tritontube.PlannedMove
+	(*DrainNodeRequest)(nil),   // 10: tritontube.DrainNodeRequest
+	(*DrainNodeResponse)(nil),  // 11: tritontube.DrainNodeResponse
+	(*ListNodesRequest)(nil),   // 12: tritontube.ListNodesRequest
+	(*ListNodesResponse)(nil),  // 13: tritontube.ListNodesResponse
+	(*NodeStatus)(nil),         // 14: tritontube.NodeStatus
+	(*RepairRequest)(nil),      // 15: tritontube.RepairRequest
+	(*RepairResponse)(nil),     // 16: tritontube.RepairResponse
+	(*RepairAction)(nil),       // 17: tritontube.RepairAction
+	(*WatchRingRequest)(nil),   // 18: tritontube.WatchRingRequest
+	(*RingUpdate)(nil),         // 19: tritontube.RingUpdate
+	(*RegisterRequest)(nil),    // 20: tritontube.RegisterRequest
+	(*RegisterResponse)(nil),   // 21: tritontube.RegisterResponse
+	(*HeartbeatRequest)(nil),   // 22: tritontube.HeartbeatRequest
+	(*HeartbeatResponse)(nil),  // 23: tritontube.HeartbeatResponse
 }
 var file_proto_admin_proto_depIdxs = []int32{
-	0, // 0: tritontube.VideoContentAdminService.AddNode:input_type -> tritontube.AddNodeRequest
-	2, // 1: tritontube.VideoContentAdminService.RemoveNode:input_type -> tritontube.RemoveNodeRequest
-	4, // 2: tritontube.VideoContentAdminService.ListNodes:input_type -> tritontube.ListNodesRequest
-	1, // 3: tritontube.VideoContentAdminService.AddNode:output_type -> tritontube.AddNodeResponse
-	3, // 4: tritontube.VideoContentAdminService.RemoveNode:output_type -> tritontube.RemoveNodeResponse
-	5, // 5: tritontube.VideoContentAdminService.ListNodes:output_type -> tritontube.ListNodesResponse
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	5,  // 0: tritontube.AddNodeRequest.options:type_name -> tritontube.MigrationOptions
+	6,  // 1: tritontube.AddNodeResponse.errors:type_name -> tritontube.MigrationError
+	5,  // 2: tritontube.RemoveNodeRequest.options:type_name -> tritontube.MigrationOptions
+	6,  // 3: tritontube.RemoveNodeResponse.errors:type_name -> tritontube.MigrationError
+	6,  // 4: tritontube.MigrationProgress.errors:type_name -> tritontube.MigrationError
+	9,  // 5: tritontube.MigrationPlan.moves:type_name -> tritontube.PlannedMove
+	5,  // 6: tritontube.DrainNodeRequest.options:type_name -> tritontube.MigrationOptions
+	14, // 7: tritontube.ListNodesResponse.statuses:type_name -> tritontube.NodeStatus
+	5,  // 8: tritontube.RepairRequest.options:type_name -> tritontube.MigrationOptions
+	17, // 9: tritontube.RepairResponse.actions:type_name -> tritontube.RepairAction
+	6,  // 10: tritontube.RepairResponse.errors:type_name -> tritontube.MigrationError
+	0,  // 11: tritontube.RingUpdate.phase:type_name -> tritontube.RingPhase
+	1,  // 12: tritontube.VideoContentAdminService.AddNode:input_type -> tritontube.AddNodeRequest
+	3,  // 13: tritontube.VideoContentAdminService.RemoveNode:input_type -> tritontube.RemoveNodeRequest
+	1,  // 14: tritontube.VideoContentAdminService.AddNodeStream:input_type -> tritontube.AddNodeRequest
+	3,  // 15: tritontube.VideoContentAdminService.RemoveNodeStream:input_type -> tritontube.RemoveNodeRequest
+	12, // 16: tritontube.VideoContentAdminService.ListNodes:input_type -> tritontube.ListNodesRequest
+	10, // 17: tritontube.VideoContentAdminService.DrainNode:input_type -> tritontube.DrainNodeRequest
+	1,  // 18: tritontube.VideoContentAdminService.PlanAddNode:input_type -> tritontube.AddNodeRequest
+	3,  // 19: tritontube.VideoContentAdminService.PlanRemoveNode:input_type -> tritontube.RemoveNodeRequest
+	15, // 20: tritontube.VideoContentAdminService.Repair:input_type -> tritontube.RepairRequest
+	18, // 21: tritontube.VideoContentAdminService.WatchRing:input_type -> tritontube.WatchRingRequest
+	20, // 22: tritontube.VideoContentAdminService.Register:input_type -> tritontube.RegisterRequest
+	22, // 23: tritontube.VideoContentAdminService.Heartbeat:input_type -> tritontube.HeartbeatRequest
+	2,  // 24: tritontube.VideoContentAdminService.AddNode:output_type -> tritontube.AddNodeResponse
+	4,  // 25: tritontube.VideoContentAdminService.RemoveNode:output_type -> tritontube.RemoveNodeResponse
+	7,  // 26: tritontube.VideoContentAdminService.AddNodeStream:output_type -> tritontube.MigrationProgress
+	7,  // 27: tritontube.VideoContentAdminService.RemoveNodeStream:output_type -> tritontube.MigrationProgress
+	13, // 28: tritontube.VideoContentAdminService.ListNodes:output_type -> tritontube.ListNodesResponse
+	11, // 29: tritontube.VideoContentAdminService.DrainNode:output_type -> tritontube.DrainNodeResponse
+	8,  // 30: tritontube.VideoContentAdminService.PlanAddNode:output_type -> tritontube.MigrationPlan
+	8,  // 31: tritontube.VideoContentAdminService.PlanRemoveNode:output_type -> tritontube.MigrationPlan
+	16, // 32: tritontube.VideoContentAdminService.Repair:output_type -> tritontube.RepairResponse
+	19, // 33: tritontube.VideoContentAdminService.WatchRing:output_type -> tritontube.RingUpdate
+	21, // 34: tritontube.VideoContentAdminService.Register:output_type -> tritontube.RegisterResponse
+	23, // 35: tritontube.VideoContentAdminService.Heartbeat:output_type -> tritontube.HeartbeatResponse
+	24, // [24:36] is the sub-list for method output_type
+	12, // [12:24] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_proto_admin_proto_init() }
@@ -340,18 +1719,20 @@ func file_proto_admin_proto_init() {
 	if File_proto_admin_proto != nil {
 		return
 	}
+	file_proto_admin_proto_msgTypes[4].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   6,
+			NumEnums:      1,
+			NumMessages:   23,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_admin_proto_goTypes,
 		DependencyIndexes: file_proto_admin_proto_depIdxs,
+		EnumInfos:         file_proto_admin_proto_enumTypes,
 		MessageInfos:      file_proto_admin_proto_msgTypes,
 	}.Build()
 	File_proto_admin_proto = out.File
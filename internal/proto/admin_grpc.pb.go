@@ -19,9 +19,18 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	VideoContentAdminService_AddNode_FullMethodName    = "/tritontube.VideoContentAdminService/AddNode"
-	VideoContentAdminService_RemoveNode_FullMethodName = "/tritontube.VideoContentAdminService/RemoveNode"
-	VideoContentAdminService_ListNodes_FullMethodName  = "/tritontube.VideoContentAdminService/ListNodes"
+	VideoContentAdminService_AddNode_FullMethodName          = "/tritontube.VideoContentAdminService/AddNode"
+	VideoContentAdminService_RemoveNode_FullMethodName       = "/tritontube.VideoContentAdminService/RemoveNode"
+	VideoContentAdminService_AddNodeStream_FullMethodName    = "/tritontube.VideoContentAdminService/AddNodeStream"
+	VideoContentAdminService_RemoveNodeStream_FullMethodName = "/tritontube.VideoContentAdminService/RemoveNodeStream"
+	VideoContentAdminService_ListNodes_FullMethodName        = "/tritontube.VideoContentAdminService/ListNodes"
+	VideoContentAdminService_DrainNode_FullMethodName        = "/tritontube.VideoContentAdminService/DrainNode"
+	VideoContentAdminService_PlanAddNode_FullMethodName      = "/tritontube.VideoContentAdminService/PlanAddNode"
+	VideoContentAdminService_PlanRemoveNode_FullMethodName   = "/tritontube.VideoContentAdminService/PlanRemoveNode"
+	VideoContentAdminService_Repair_FullMethodName           = "/tritontube.VideoContentAdminService/Repair"
+	VideoContentAdminService_WatchRing_FullMethodName        = "/tritontube.VideoContentAdminService/WatchRing"
+	VideoContentAdminService_Register_FullMethodName         = "/tritontube.VideoContentAdminService/Register"
+	VideoContentAdminService_Heartbeat_FullMethodName        = "/tritontube.VideoContentAdminService/Heartbeat"
 )
 
 // VideoContentAdminServiceClient is the client API for VideoContentAdminService service.
@@ -30,7 +39,18 @@ const (
 type VideoContentAdminServiceClient interface {
 	AddNode(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (*AddNodeResponse, error)
 	RemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*RemoveNodeResponse, error)
+	AddNodeStream(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MigrationProgress], error)
+	RemoveNodeStream(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MigrationProgress], error)
 	ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error)
+	DrainNode(ctx context.Context, in *DrainNodeRequest, opts ...grpc.CallOption) (*DrainNodeResponse, error)
+	PlanAddNode(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (*MigrationPlan, error)
+	PlanRemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*MigrationPlan, error)
+	Repair(ctx context.Context, in *RepairRequest, opts ...grpc.CallOption) (*RepairResponse, error)
+	// watchers acknowledge each ring version once they route with it
+	WatchRing(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[WatchRingRequest, RingUpdate], error)
+	// called by storage nodes started with -coordinator
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
 }
 
 type videoContentAdminServiceClient struct {
@@ -61,6 +81,44 @@ func (c *videoContentAdminServiceClient) RemoveNode(ctx context.Context, in *Rem
 	return out, nil
 }
 
+func (c *videoContentAdminServiceClient) AddNodeStream(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MigrationProgress], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VideoContentAdminService_ServiceDesc.Streams[0], VideoContentAdminService_AddNodeStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AddNodeRequest, MigrationProgress]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentAdminService_AddNodeStreamClient = grpc.ServerStreamingClient[MigrationProgress]
+
+func (c *videoContentAdminServiceClient) RemoveNodeStream(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MigrationProgress], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VideoContentAdminService_ServiceDesc.Streams[1], VideoContentAdminService_RemoveNodeStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RemoveNodeRequest, MigrationProgress]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentAdminService_RemoveNodeStreamClient = grpc.ServerStreamingClient[MigrationProgress]
+
 func (c *videoContentAdminServiceClient) ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(ListNodesResponse)
@@ -71,13 +129,97 @@ func (c *videoContentAdminServiceClient) ListNodes(ctx context.Context, in *List
 	return out, nil
 }
 
+func (c *videoContentAdminServiceClient) DrainNode(ctx context.Context, in *DrainNodeRequest, opts ...grpc.CallOption) (*DrainNodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DrainNodeResponse)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_DrainNode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoContentAdminServiceClient) PlanAddNode(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (*MigrationPlan, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MigrationPlan)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_PlanAddNode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoContentAdminServiceClient) PlanRemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*MigrationPlan, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MigrationPlan)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_PlanRemoveNode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoContentAdminServiceClient) Repair(ctx context.Context, in *RepairRequest, opts ...grpc.CallOption) (*RepairResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RepairResponse)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_Repair_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoContentAdminServiceClient) WatchRing(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[WatchRingRequest, RingUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VideoContentAdminService_ServiceDesc.Streams[2], VideoContentAdminService_WatchRing_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRingRequest, RingUpdate]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentAdminService_WatchRingClient = grpc.BidiStreamingClient[WatchRingRequest, RingUpdate]
+
+func (c *videoContentAdminServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoContentAdminServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // VideoContentAdminServiceServer is the server API for VideoContentAdminService service.
 // All implementations must embed UnimplementedVideoContentAdminServiceServer
 // for forward compatibility.
 type VideoContentAdminServiceServer interface {
 	AddNode(context.Context, *AddNodeRequest) (*AddNodeResponse, error)
 	RemoveNode(context.Context, *RemoveNodeRequest) (*RemoveNodeResponse, error)
+	AddNodeStream(*AddNodeRequest, grpc.ServerStreamingServer[MigrationProgress]) error
+	RemoveNodeStream(*RemoveNodeRequest, grpc.ServerStreamingServer[MigrationProgress]) error
 	ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error)
+	DrainNode(context.Context, *DrainNodeRequest) (*DrainNodeResponse, error)
+	PlanAddNode(context.Context, *AddNodeRequest) (*MigrationPlan, error)
+	PlanRemoveNode(context.Context, *RemoveNodeRequest) (*MigrationPlan, error)
+	Repair(context.Context, *RepairRequest) (*RepairResponse, error)
+	// watchers acknowledge each ring version once they route with it
+	WatchRing(grpc.BidiStreamingServer[WatchRingRequest, RingUpdate]) error
+	// called by storage nodes started with -coordinator
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
 	mustEmbedUnimplementedVideoContentAdminServiceServer()
 }
 
@@ -94,9 +236,36 @@ func (UnimplementedVideoContentAdminServiceServer) AddNode(context.Context, *Add
 func (UnimplementedVideoContentAdminServiceServer) RemoveNode(context.Context, *RemoveNodeRequest) (*RemoveNodeResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveNode not implemented")
 }
+func (UnimplementedVideoContentAdminServiceServer) AddNodeStream(*AddNodeRequest, grpc.ServerStreamingServer[MigrationProgress]) error {
+	return status.Errorf(codes.Unimplemented, "method AddNodeStream not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) RemoveNodeStream(*RemoveNodeRequest, grpc.ServerStreamingServer[MigrationProgress]) error {
+	return status.Errorf(codes.Unimplemented, "method RemoveNodeStream not implemented")
+}
 func (UnimplementedVideoContentAdminServiceServer) ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListNodes not implemented")
 }
+func (UnimplementedVideoContentAdminServiceServer) DrainNode(context.Context, *DrainNodeRequest) (*DrainNodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DrainNode not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) PlanAddNode(context.Context, *AddNodeRequest) (*MigrationPlan, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PlanAddNode not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) PlanRemoveNode(context.Context, *RemoveNodeRequest) (*MigrationPlan, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PlanRemoveNode not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) Repair(context.Context, *RepairRequest) (*RepairResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Repair not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) WatchRing(grpc.BidiStreamingServer[WatchRingRequest, RingUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRing not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
 func (UnimplementedVideoContentAdminServiceServer) mustEmbedUnimplementedVideoContentAdminServiceServer() {
 }
 func (UnimplementedVideoContentAdminServiceServer) testEmbeddedByValue() {}
@@ -155,6 +324,28 @@ func _VideoContentAdminService_RemoveNode_Handler(srv interface{}, ctx context.C
 	return interceptor(ctx, in, info, handler)
 }
 
+func _VideoContentAdminService_AddNodeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AddNodeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VideoContentAdminServiceServer).AddNodeStream(m, &grpc.GenericServerStream[AddNodeRequest, MigrationProgress]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentAdminService_AddNodeStreamServer = grpc.ServerStreamingServer[MigrationProgress]
+
+func _VideoContentAdminService_RemoveNodeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RemoveNodeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VideoContentAdminServiceServer).RemoveNodeStream(m, &grpc.GenericServerStream[RemoveNodeRequest, MigrationProgress]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentAdminService_RemoveNodeStreamServer = grpc.ServerStreamingServer[MigrationProgress]
+
 func _VideoContentAdminService_ListNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ListNodesRequest)
 	if err := dec(in); err != nil {
@@ -173,6 +364,121 @@ func _VideoContentAdminService_ListNodes_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _VideoContentAdminService_DrainNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).DrainNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_DrainNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).DrainNode(ctx, req.(*DrainNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoContentAdminService_PlanAddNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).PlanAddNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_PlanAddNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).PlanAddNode(ctx, req.(*AddNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoContentAdminService_PlanRemoveNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).PlanRemoveNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_PlanRemoveNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).PlanRemoveNode(ctx, req.(*RemoveNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoContentAdminService_Repair_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RepairRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).Repair(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_Repair_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).Repair(ctx, req.(*RepairRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoContentAdminService_WatchRing_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(VideoContentAdminServiceServer).WatchRing(&grpc.GenericServerStream[WatchRingRequest, RingUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentAdminService_WatchRingServer = grpc.BidiStreamingServer[WatchRingRequest, RingUpdate]
+
+func _VideoContentAdminService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoContentAdminService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // VideoContentAdminService_ServiceDesc is the grpc.ServiceDesc for VideoContentAdminService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -192,7 +498,48 @@ var VideoContentAdminService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListNodes",
 			Handler:    _VideoContentAdminService_ListNodes_Handler,
 		},
+		{
+			MethodName: "DrainNode",
+			Handler:    _VideoContentAdminService_DrainNode_Handler,
+		},
+		{
+			MethodName: "PlanAddNode",
+			Handler:    _VideoContentAdminService_PlanAddNode_Handler,
+		},
+		{
+			MethodName: "PlanRemoveNode",
+			Handler:    _VideoContentAdminService_PlanRemoveNode_Handler,
+		},
+		{
+			MethodName: "Repair",
+			Handler:    _VideoContentAdminService_Repair_Handler,
+		},
+		{
+			MethodName: "Register",
+			Handler:    _VideoContentAdminService_Register_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _VideoContentAdminService_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AddNodeStream",
+			Handler:       _VideoContentAdminService_AddNodeStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "RemoveNodeStream",
+			Handler:       _VideoContentAdminService_RemoveNodeStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchRing",
+			Handler:       _VideoContentAdminService_WatchRing_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/admin.proto",
 }
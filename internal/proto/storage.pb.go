@@ -74,8 +74,11 @@ func (x *ReadRequest) GetFileName() string {
 }
 
 type ReadResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	FileData      []byte                 `protobuf:"bytes,2,opt,name=fileData,proto3" json:"fileData,omitempty"`
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	FileData []byte                 `protobuf:"bytes,2,opt,name=fileData,proto3" json:"fileData,omitempty"`
+	// SHA-256 stored when the file was written, empty for files written
+	// before checksums were kept
+	Sha256        []byte `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -117,11 +120,21 @@ func (x *ReadResponse) GetFileData() []byte {
 	return nil
 }
 
+func (x *ReadResponse) GetSha256() []byte {
+	if x != nil {
+		return x.Sha256
+	}
+	return nil
+}
+
 type WriteRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	VideoId       string                 `protobuf:"bytes,1,opt,name=videoId,proto3" json:"videoId,omitempty"`
-	FileName      string                 `protobuf:"bytes,2,opt,name=fileName,proto3" json:"fileName,omitempty"`
-	FileData      []byte                 `protobuf:"bytes,3,opt,name=fileData,proto3" json:"fileData,omitempty"`
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	VideoId  string                 `protobuf:"bytes,1,opt,name=videoId,proto3" json:"videoId,omitempty"`
+	FileName string                 `protobuf:"bytes,2,opt,name=fileName,proto3" json:"fileName,omitempty"`
+	FileData []byte                 `protobuf:"bytes,3,opt,name=fileData,proto3" json:"fileData,omitempty"`
+	// SHA-256 of fileData; the write is rejected if it does not match.
+	// If empty the node computes it.
+	Sha256        []byte `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -177,6 +190,13 @@ func (x *WriteRequest) GetFileData() []byte {
 	return nil
 }
 
+func (x *WriteRequest) GetSha256() []byte {
+	if x != nil {
+		return x.Sha256
+	}
+	return nil
+}
+
 type WriteResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -302,7 +322,18 @@ func (*RemoveResponse) Descriptor() ([]byte, []int) {
 }
 
 type ListRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// only files of videos whose id starts with this
+	VideoPrefix string `protobuf:"bytes,1,opt,name=video_prefix,json=videoPrefix,proto3" json:"video_prefix,omitempty"`
+	// only files whose "<videoId>/<fileName>" key hashes into
+	// (hash_start, hash_end], wrapping around when hash_end <= hash_start
+	HashRange bool   `protobuf:"varint,2,opt,name=hash_range,json=hashRange,proto3" json:"hash_range,omitempty"`
+	HashStart uint64 `protobuf:"varint,3,opt,name=hash_start,json=hashStart,proto3" json:"hash_start,omitempty"`
+	HashEnd   uint64 `protobuf:"varint,4,opt,name=hash_end,json=hashEnd,proto3" json:"hash_end,omitempty"`
+	// files per page, 0 for the node's maximum
+	PageSize int32 `protobuf:"varint,5,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page, empty for the first one
+	PageToken     string `protobuf:"bytes,6,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -337,9 +368,55 @@ func (*ListRequest) Descriptor() ([]byte, []int) {
 	return file_proto_storage_proto_rawDescGZIP(), []int{6}
 }
 
+func (x *ListRequest) GetVideoPrefix() string {
+	if x != nil {
+		return x.VideoPrefix
+	}
+	return ""
+}
+
+func (x *ListRequest) GetHashRange() bool {
+	if x != nil {
+		return x.HashRange
+	}
+	return false
+}
+
+func (x *ListRequest) GetHashStart() uint64 {
+	if x != nil {
+		return x.HashStart
+	}
+	return 0
+}
+
+func (x *ListRequest) GetHashEnd() uint64 {
+	if x != nil {
+		return x.HashEnd
+	}
+	return 0
+}
+
+func (x *ListRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
 type ListResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Files         []string               `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Files []string               `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	// same files as above, with their sizes
+	Infos []*FileInfo `protobuf:"bytes,2,rep,name=infos,proto3" json:"infos,omitempty"`
+	// set when there are more files to list
+	NextPageToken string `protobuf:"bytes,3,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -381,34 +458,919 @@ func (x *ListResponse) GetFiles() []string {
 	return nil
 }
 
-var File_proto_storage_proto protoreflect.FileDescriptor
+func (x *ListResponse) GetInfos() []*FileInfo {
+	if x != nil {
+		return x.Infos
+	}
+	return nil
+}
 
-const file_proto_storage_proto_rawDesc = "" +
-	"\n" +
-	"\x13proto/storage.proto\x12\n" +
-	"tritontube\"C\n" +
-	"\vReadRequest\x12\x18\n" +
-	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
-	"\bfileName\x18\x02 \x01(\tR\bfileName\"*\n" +
-	"\fReadResponse\x12\x1a\n" +
-	"\bfileData\x18\x02 \x01(\fR\bfileData\"`\n" +
-	"\fWriteRequest\x12\x18\n" +
-	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
-	"\bfileName\x18\x02 \x01(\tR\bfileName\x12\x1a\n" +
-	"\bfileData\x18\x03 \x01(\fR\bfileData\"\x0f\n" +
-	"\rWriteResponse\"E\n" +
-	"\rRemoveRequest\x12\x18\n" +
-	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
-	"\bfileName\x18\x02 \x01(\tR\bfileName\"\x10\n" +
-	"\x0eRemoveResponse\"\r\n" +
-	"\vListRequest\"$\n" +
-	"\fListResponse\x12\x14\n" +
-	"\x05files\x18\x01 \x03(\tR\x05files2\x85\x02\n" +
-	"\x0eStorageService\x129\n" +
-	"\x04Read\x12\x17.tritontube.ReadRequest\x1a\x18.tritontube.ReadResponse\x12<\n" +
-	"\x05Write\x12\x18.tritontube.WriteRequest\x1a\x19.tritontube.WriteResponse\x12?\n" +
-	"\x06Remove\x12\x19.tritontube.RemoveRequest\x1a\x1a.tritontube.RemoveResponse\x129\n" +
-	"\x04List\x12\x17.tritontube.ListRequest\x1a\x18.tritontube.ListResponseB\x16Z\x14internal/proto;protob\x06proto3"
+func (x *ListResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+type FileInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileInfo) Reset() {
+	*x = FileInfo{}
+	mi := &file_proto_storage_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileInfo) ProtoMessage() {}
+
+func (x *FileInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *FileInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type StatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsRequest) Reset() {
+	*x = StatsRequest{}
+	mi := &file_proto_storage_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRequest) ProtoMessage() {}
+
+func (x *StatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{9}
+}
+
+type StatsResponse struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	FileCount  int64                  `protobuf:"varint,1,opt,name=file_count,json=fileCount,proto3" json:"file_count,omitempty"`
+	TotalBytes int64                  `protobuf:"varint,2,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+	Videos     []*VideoStats          `protobuf:"bytes,3,rep,name=videos,proto3" json:"videos,omitempty"`
+	// free space on the disk holding the base directory, 0 if unknown
+	FreeBytes int64 `protobuf:"varint,4,opt,name=free_bytes,json=freeBytes,proto3" json:"free_bytes,omitempty"`
+	UptimeMs  int64 `protobuf:"varint,5,opt,name=uptime_ms,json=uptimeMs,proto3" json:"uptime_ms,omitempty"`
+	// files whose contents did not match their checksum in the last scrub
+	CorruptFiles []string `protobuf:"bytes,6,rep,name=corrupt_files,json=corruptFiles,proto3" json:"corrupt_files,omitempty"`
+	// when the last scrub finished, 0 if none has
+	LastScrubUnixMs int64 `protobuf:"varint,7,opt,name=last_scrub_unix_ms,json=lastScrubUnixMs,proto3" json:"last_scrub_unix_ms,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *StatsResponse) Reset() {
+	*x = StatsResponse{}
+	mi := &file_proto_storage_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsResponse) ProtoMessage() {}
+
+func (x *StatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsResponse.ProtoReflect.Descriptor instead.
+func (*StatsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StatsResponse) GetFileCount() int64 {
+	if x != nil {
+		return x.FileCount
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetTotalBytes() int64 {
+	if x != nil {
+		return x.TotalBytes
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetVideos() []*VideoStats {
+	if x != nil {
+		return x.Videos
+	}
+	return nil
+}
+
+func (x *StatsResponse) GetFreeBytes() int64 {
+	if x != nil {
+		return x.FreeBytes
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetUptimeMs() int64 {
+	if x != nil {
+		return x.UptimeMs
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetCorruptFiles() []string {
+	if x != nil {
+		return x.CorruptFiles
+	}
+	return nil
+}
+
+func (x *StatsResponse) GetLastScrubUnixMs() int64 {
+	if x != nil {
+		return x.LastScrubUnixMs
+	}
+	return 0
+}
+
+type VideoStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VideoId       string                 `protobuf:"bytes,1,opt,name=video_id,json=videoId,proto3" json:"video_id,omitempty"`
+	FileCount     int64                  `protobuf:"varint,2,opt,name=file_count,json=fileCount,proto3" json:"file_count,omitempty"`
+	Bytes         int64                  `protobuf:"varint,3,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VideoStats) Reset() {
+	*x = VideoStats{}
+	mi := &file_proto_storage_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VideoStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VideoStats) ProtoMessage() {}
+
+func (x *VideoStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VideoStats.ProtoReflect.Descriptor instead.
+func (*VideoStats) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *VideoStats) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+func (x *VideoStats) GetFileCount() int64 {
+	if x != nil {
+		return x.FileCount
+	}
+	return 0
+}
+
+func (x *VideoStats) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+// Stat fails with NOT_FOUND if the file does not exist, as do Read and
+// Remove.
+type StatRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	VideoId  string                 `protobuf:"bytes,1,opt,name=videoId,proto3" json:"videoId,omitempty"`
+	FileName string                 `protobuf:"bytes,2,opt,name=fileName,proto3" json:"fileName,omitempty"`
+	// re-hash the file on the node; fails with DATA_LOSS if it no longer
+	// matches its checksum
+	Verify        bool `protobuf:"varint,3,opt,name=verify,proto3" json:"verify,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatRequest) Reset() {
+	*x = StatRequest{}
+	mi := &file_proto_storage_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatRequest) ProtoMessage() {}
+
+func (x *StatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatRequest.ProtoReflect.Descriptor instead.
+func (*StatRequest) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StatRequest) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+func (x *StatRequest) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *StatRequest) GetVerify() bool {
+	if x != nil {
+		return x.Verify
+	}
+	return false
+}
+
+type StatResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Size        int64                  `protobuf:"varint,1,opt,name=size,proto3" json:"size,omitempty"`
+	MtimeUnixMs int64                  `protobuf:"varint,2,opt,name=mtime_unix_ms,json=mtimeUnixMs,proto3" json:"mtime_unix_ms,omitempty"`
+	// SHA-256 stored when the file was written
+	Sha256        []byte `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatResponse) Reset() {
+	*x = StatResponse{}
+	mi := &file_proto_storage_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatResponse) ProtoMessage() {}
+
+func (x *StatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatResponse.ProtoReflect.Descriptor instead.
+func (*StatResponse) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StatResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *StatResponse) GetMtimeUnixMs() int64 {
+	if x != nil {
+		return x.MtimeUnixMs
+	}
+	return 0
+}
+
+func (x *StatResponse) GetSha256() []byte {
+	if x != nil {
+		return x.Sha256
+	}
+	return nil
+}
+
+type ExistsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VideoId       string                 `protobuf:"bytes,1,opt,name=videoId,proto3" json:"videoId,omitempty"`
+	FileName      string                 `protobuf:"bytes,2,opt,name=fileName,proto3" json:"fileName,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExistsRequest) Reset() {
+	*x = ExistsRequest{}
+	mi := &file_proto_storage_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExistsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExistsRequest) ProtoMessage() {}
+
+func (x *ExistsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExistsRequest.ProtoReflect.Descriptor instead.
+func (*ExistsRequest) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ExistsRequest) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+func (x *ExistsRequest) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+type ExistsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exists        bool                   `protobuf:"varint,1,opt,name=exists,proto3" json:"exists,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExistsResponse) Reset() {
+	*x = ExistsResponse{}
+	mi := &file_proto_storage_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExistsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExistsResponse) ProtoMessage() {}
+
+func (x *ExistsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExistsResponse.ProtoReflect.Descriptor instead.
+func (*ExistsResponse) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ExistsResponse) GetExists() bool {
+	if x != nil {
+		return x.Exists
+	}
+	return false
+}
+
+// DeleteVideo removes every file of a video on the node and its directory.
+// Deleting a video the node holds nothing of succeeds.
+type DeleteVideoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VideoId       string                 `protobuf:"bytes,1,opt,name=videoId,proto3" json:"videoId,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteVideoRequest) Reset() {
+	*x = DeleteVideoRequest{}
+	mi := &file_proto_storage_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteVideoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteVideoRequest) ProtoMessage() {}
+
+func (x *DeleteVideoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteVideoRequest.ProtoReflect.Descriptor instead.
+func (*DeleteVideoRequest) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *DeleteVideoRequest) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+type DeleteVideoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FilesDeleted  int32                  `protobuf:"varint,1,opt,name=files_deleted,json=filesDeleted,proto3" json:"files_deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteVideoResponse) Reset() {
+	*x = DeleteVideoResponse{}
+	mi := &file_proto_storage_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteVideoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteVideoResponse) ProtoMessage() {}
+
+func (x *DeleteVideoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteVideoResponse.ProtoReflect.Descriptor instead.
+func (*DeleteVideoResponse) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *DeleteVideoResponse) GetFilesDeleted() int32 {
+	if x != nil {
+		return x.FilesDeleted
+	}
+	return 0
+}
+
+type WriteBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FilesWritten  int32                  `protobuf:"varint,1,opt,name=files_written,json=filesWritten,proto3" json:"files_written,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteBatchResponse) Reset() {
+	*x = WriteBatchResponse{}
+	mi := &file_proto_storage_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteBatchResponse) ProtoMessage() {}
+
+func (x *WriteBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteBatchResponse.ProtoReflect.Descriptor instead.
+func (*WriteBatchResponse) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *WriteBatchResponse) GetFilesWritten() int32 {
+	if x != nil {
+		return x.FilesWritten
+	}
+	return 0
+}
+
+type ReadStreamRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VideoId       string                 `protobuf:"bytes,1,opt,name=videoId,proto3" json:"videoId,omitempty"`
+	FileName      string                 `protobuf:"bytes,2,opt,name=fileName,proto3" json:"fileName,omitempty"`
+	Offset        int64                  `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadStreamRequest) Reset() {
+	*x = ReadStreamRequest{}
+	mi := &file_proto_storage_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadStreamRequest) ProtoMessage() {}
+
+func (x *ReadStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadStreamRequest.ProtoReflect.Descriptor instead.
+func (*ReadStreamRequest) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ReadStreamRequest) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+func (x *ReadStreamRequest) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *ReadStreamRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type ReadStreamResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Data  []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// set on the first message only
+	Size          int64  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	MtimeUnixMs   int64  `protobuf:"varint,3,opt,name=mtime_unix_ms,json=mtimeUnixMs,proto3" json:"mtime_unix_ms,omitempty"`
+	Sha256        []byte `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadStreamResponse) Reset() {
+	*x = ReadStreamResponse{}
+	mi := &file_proto_storage_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadStreamResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadStreamResponse) ProtoMessage() {}
+
+func (x *ReadStreamResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadStreamResponse.ProtoReflect.Descriptor instead.
+func (*ReadStreamResponse) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *ReadStreamResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ReadStreamResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ReadStreamResponse) GetMtimeUnixMs() int64 {
+	if x != nil {
+		return x.MtimeUnixMs
+	}
+	return 0
+}
+
+func (x *ReadStreamResponse) GetSha256() []byte {
+	if x != nil {
+		return x.Sha256
+	}
+	return nil
+}
+
+type WriteStreamRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VideoId       string                 `protobuf:"bytes,1,opt,name=videoId,proto3" json:"videoId,omitempty"`
+	FileName      string                 `protobuf:"bytes,2,opt,name=fileName,proto3" json:"fileName,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Sha256        []byte                 `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WriteStreamRequest) Reset() {
+	*x = WriteStreamRequest{}
+	mi := &file_proto_storage_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WriteStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WriteStreamRequest) ProtoMessage() {}
+
+func (x *WriteStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WriteStreamRequest.ProtoReflect.Descriptor instead.
+func (*WriteStreamRequest) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *WriteStreamRequest) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+func (x *WriteStreamRequest) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *WriteStreamRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *WriteStreamRequest) GetSha256() []byte {
+	if x != nil {
+		return x.Sha256
+	}
+	return nil
+}
+
+var File_proto_storage_proto protoreflect.FileDescriptor
+
+const file_proto_storage_proto_rawDesc = "" +
+	"\n" +
+	"\x13proto/storage.proto\x12\n" +
+	"tritontube\"C\n" +
+	"\vReadRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfileName\x18\x02 \x01(\tR\bfileName\"B\n" +
+	"\fReadResponse\x12\x1a\n" +
+	"\bfileData\x18\x02 \x01(\fR\bfileData\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\fR\x06sha256\"x\n" +
+	"\fWriteRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfileName\x18\x02 \x01(\tR\bfileName\x12\x1a\n" +
+	"\bfileData\x18\x03 \x01(\fR\bfileData\x12\x16\n" +
+	"\x06sha256\x18\x04 \x01(\fR\x06sha256\"\x0f\n" +
+	"\rWriteResponse\"E\n" +
+	"\rRemoveRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfileName\x18\x02 \x01(\tR\bfileName\"\x10\n" +
+	"\x0eRemoveResponse\"\xc5\x01\n" +
+	"\vListRequest\x12!\n" +
+	"\fvideo_prefix\x18\x01 \x01(\tR\vvideoPrefix\x12\x1d\n" +
+	"\n" +
+	"hash_range\x18\x02 \x01(\bR\thashRange\x12\x1d\n" +
+	"\n" +
+	"hash_start\x18\x03 \x01(\x04R\thashStart\x12\x19\n" +
+	"\bhash_end\x18\x04 \x01(\x04R\ahashEnd\x12\x1b\n" +
+	"\tpage_size\x18\x05 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x06 \x01(\tR\tpageToken\"x\n" +
+	"\fListResponse\x12\x14\n" +
+	"\x05files\x18\x01 \x03(\tR\x05files\x12*\n" +
+	"\x05infos\x18\x02 \x03(\v2\x14.tritontube.FileInfoR\x05infos\x12&\n" +
+	"\x0fnext_page_token\x18\x03 \x01(\tR\rnextPageToken\"2\n" +
+	"\bFileInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\"\x0e\n" +
+	"\fStatsRequest\"\x8d\x02\n" +
+	"\rStatsResponse\x12\x1d\n" +
+	"\n" +
+	"file_count\x18\x01 \x01(\x03R\tfileCount\x12\x1f\n" +
+	"\vtotal_bytes\x18\x02 \x01(\x03R\n" +
+	"totalBytes\x12.\n" +
+	"\x06videos\x18\x03 \x03(\v2\x16.tritontube.VideoStatsR\x06videos\x12\x1d\n" +
+	"\n" +
+	"free_bytes\x18\x04 \x01(\x03R\tfreeBytes\x12\x1b\n" +
+	"\tuptime_ms\x18\x05 \x01(\x03R\buptimeMs\x12#\n" +
+	"\rcorrupt_files\x18\x06 \x03(\tR\fcorruptFiles\x12+\n" +
+	"\x12last_scrub_unix_ms\x18\a \x01(\x03R\x0flastScrubUnixMs\"\\\n" +
+	"\n" +
+	"VideoStats\x12\x19\n" +
+	"\bvideo_id\x18\x01 \x01(\tR\avideoId\x12\x1d\n" +
+	"\n" +
+	"file_count\x18\x02 \x01(\x03R\tfileCount\x12\x14\n" +
+	"\x05bytes\x18\x03 \x01(\x03R\x05bytes\"[\n" +
+	"\vStatRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfileName\x18\x02 \x01(\tR\bfileName\x12\x16\n" +
+	"\x06verify\x18\x03 \x01(\bR\x06verify\"^\n" +
+	"\fStatResponse\x12\x12\n" +
+	"\x04size\x18\x01 \x01(\x03R\x04size\x12\"\n" +
+	"\rmtime_unix_ms\x18\x02 \x01(\x03R\vmtimeUnixMs\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\fR\x06sha256\"E\n" +
+	"\rExistsRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfileName\x18\x02 \x01(\tR\bfileName\"(\n" +
+	"\x0eExistsResponse\x12\x16\n" +
+	"\x06exists\x18\x01 \x01(\bR\x06exists\".\n" +
+	"\x12DeleteVideoRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\":\n" +
+	"\x13DeleteVideoResponse\x12#\n" +
+	"\rfiles_deleted\x18\x01 \x01(\x05R\ffilesDeleted\"9\n" +
+	"\x12WriteBatchResponse\x12#\n" +
+	"\rfiles_written\x18\x01 \x01(\x05R\ffilesWritten\"a\n" +
+	"\x11ReadStreamRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfileName\x18\x02 \x01(\tR\bfileName\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x03R\x06offset\"x\n" +
+	"\x12ReadStreamResponse\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\"\n" +
+	"\rmtime_unix_ms\x18\x03 \x01(\x03R\vmtimeUnixMs\x12\x16\n" +
+	"\x06sha256\x18\x04 \x01(\fR\x06sha256\"v\n" +
+	"\x12WriteStreamRequest\x12\x18\n" +
+	"\avideoId\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfileName\x18\x02 \x01(\tR\bfileName\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12\x16\n" +
+	"\x06sha256\x18\x04 \x01(\fR\x06sha2562\xf4\x05\n" +
+	"\x0eStorageService\x129\n" +
+	"\x04Read\x12\x17.tritontube.ReadRequest\x1a\x18.tritontube.ReadResponse\x12<\n" +
+	"\x05Write\x12\x18.tritontube.WriteRequest\x1a\x19.tritontube.WriteResponse\x12?\n" +
+	"\x06Remove\x12\x19.tritontube.RemoveRequest\x1a\x1a.tritontube.RemoveResponse\x129\n" +
+	"\x04List\x12\x17.tritontube.ListRequest\x1a\x18.tritontube.ListResponse\x12<\n" +
+	"\x05Stats\x12\x18.tritontube.StatsRequest\x1a\x19.tritontube.StatsResponse\x129\n" +
+	"\x04Stat\x12\x17.tritontube.StatRequest\x1a\x18.tritontube.StatResponse\x12?\n" +
+	"\x06Exists\x12\x19.tritontube.ExistsRequest\x1a\x1a.tritontube.ExistsResponse\x12N\n" +
+	"\vDeleteVideo\x12\x1e.tritontube.DeleteVideoRequest\x1a\x1f.tritontube.DeleteVideoResponse\x12H\n" +
+	"\n" +
+	"WriteBatch\x12\x18.tritontube.WriteRequest\x1a\x1e.tritontube.WriteBatchResponse(\x01\x12M\n" +
+	"\n" +
+	"ReadStream\x12\x1d.tritontube.ReadStreamRequest\x1a\x1e.tritontube.ReadStreamResponse0\x01\x12J\n" +
+	"\vWriteStream\x12\x1e.tritontube.WriteStreamRequest\x1a\x19.tritontube.WriteResponse(\x01B\x16Z\x14internal/proto;protob\x06proto3"
 
 var (
 	file_proto_storage_proto_rawDescOnce sync.Once
@@ -422,31 +1384,61 @@ func file_proto_storage_proto_rawDescGZIP() []byte {
 	return file_proto_storage_proto_rawDescData
 }
 
-var file_proto_storage_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proto_storage_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
 var file_proto_storage_proto_goTypes = []any{
-	(*ReadRequest)(nil),    // 0: tritontube.ReadRequest
-	(*ReadResponse)(nil),   // 1: tritontube.ReadResponse
-	(*WriteRequest)(nil),   // 2: tritontube.WriteRequest
-	(*WriteResponse)(nil),  // 3: tritontube.WriteResponse
-	(*RemoveRequest)(nil),  // 4: tritontube.RemoveRequest
-	(*RemoveResponse)(nil), // 5: tritontube.RemoveResponse
-	(*ListRequest)(nil),    // 6: tritontube.ListRequest
-	(*ListResponse)(nil),   // 7: tritontube.ListResponse
+	(*ReadRequest)(nil),         // 0: tritontube.ReadRequest
+	(*ReadResponse)(nil),        // 1: tritontube.ReadResponse
+	(*WriteRequest)(nil),        // 2: tritontube.WriteRequest
+	(*WriteResponse)(nil),       // 3: tritontube.WriteResponse
+	(*RemoveRequest)(nil),       // 4: tritontube.RemoveRequest
+	(*RemoveResponse)(nil),      // 5: tritontube.RemoveResponse
+	(*ListRequest)(nil),         // 6: tritontube.ListRequest
+	(*ListResponse)(nil),        // 7: tritontube.ListResponse
+	(*FileInfo)(nil),            // 8: tritontube.FileInfo
+	(*StatsRequest)(nil),        // 9: tritontube.StatsRequest
+	(*StatsResponse)(nil),       // 10: tritontube.StatsResponse
+	(*VideoStats)(nil),          // 11: tritontube.VideoStats
+	(*StatRequest)(nil),         // 12: tritontube.StatRequest
+	(*StatResponse)(nil),        // 13: tritontube.StatResponse
+	(*ExistsRequest)(nil),       // 14: tritontube.ExistsRequest
+	(*ExistsResponse)(nil),      // 15: tritontube.ExistsResponse
+	(*DeleteVideoRequest)(nil),  // 16: tritontube.DeleteVideoRequest
+	(*DeleteVideoResponse)(nil), // 17: tritontube.DeleteVideoResponse
+	(*WriteBatchResponse)(nil),  // 18: tritontube.WriteBatchResponse
+	(*ReadStreamRequest)(nil),   // 19: tritontube.ReadStreamRequest
+	(*ReadStreamResponse)(nil),  // 20: tritontube.ReadStreamResponse
+	(*WriteStreamRequest)(nil),  // 21: tritontube.WriteStreamRequest
 }
 var file_proto_storage_proto_depIdxs = []int32{
-	0, // 0: tritontube.StorageService.Read:input_type -> tritontube.ReadRequest
-	2, // 1: tritontube.StorageService.Write:input_type -> tritontube.WriteRequest
-	4, // 2: tritontube.StorageService.Remove:input_type -> tritontube.RemoveRequest
-	6, // 3: tritontube.StorageService.List:input_type -> tritontube.ListRequest
-	1, // 4: tritontube.StorageService.Read:output_type -> tritontube.ReadResponse
-	3, // 5: tritontube.StorageService.Write:output_type -> tritontube.WriteResponse
-	5, // 6: tritontube.StorageService.Remove:output_type -> tritontube.RemoveResponse
-	7, // 7: tritontube.StorageService.List:output_type -> tritontube.ListResponse
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	8,  // 0: tritontube.ListResponse.infos:type_name -> tritontube.FileInfo
+	11, // 1: tritontube.StatsResponse.videos:type_name -> tritontube.VideoStats
+	0,  // 2: tritontube.StorageService.Read:input_type -> tritontube.ReadRequest
+	2,  // 3: tritontube.StorageService.Write:input_type -> tritontube.WriteRequest
+	4,  // 4: tritontube.StorageService.Remove:input_type -> tritontube.RemoveRequest
+	6,  // 5: tritontube.StorageService.List:input_type -> tritontube.ListRequest
+	9,  // 6: tritontube.StorageService.Stats:input_type -> tritontube.StatsRequest
+	12, // 7: tritontube.StorageService.Stat:input_type -> tritontube.StatRequest
+	14, // 8: tritontube.StorageService.Exists:input_type -> tritontube.ExistsRequest
+	16, // 9: tritontube.StorageService.DeleteVideo:input_type -> tritontube.DeleteVideoRequest
+	2,  // 10: tritontube.StorageService.WriteBatch:input_type -> tritontube.WriteRequest
+	19, // 11: tritontube.StorageService.ReadStream:input_type -> tritontube.ReadStreamRequest
+	21, // 12: tritontube.StorageService.WriteStream:input_type -> tritontube.WriteStreamRequest
+	1,  // 13: tritontube.StorageService.Read:output_type -> tritontube.ReadResponse
+	3,  // 14: tritontube.StorageService.Write:output_type -> tritontube.WriteResponse
+	5,  // 15: tritontube.StorageService.Remove:output_type -> tritontube.RemoveResponse
+	7,  // 16: tritontube.StorageService.List:output_type -> tritontube.ListResponse
+	10, // 17: tritontube.StorageService.Stats:output_type -> tritontube.StatsResponse
+	13, // 18: tritontube.StorageService.Stat:output_type -> tritontube.StatResponse
+	15, // 19: tritontube.StorageService.Exists:output_type -> tritontube.ExistsResponse
+	17, // 20: tritontube.StorageService.DeleteVideo:output_type -> tritontube.DeleteVideoResponse
+	18, // 21: tritontube.StorageService.WriteBatch:output_type -> tritontube.WriteBatchResponse
+	20, // 22: tritontube.StorageService.ReadStream:output_type -> tritontube.ReadStreamResponse
+	3,  // 23: tritontube.StorageService.WriteStream:output_type -> tritontube.WriteResponse
+	13, // [13:24] is the sub-list for method output_type
+	2,  // [2:13] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_proto_storage_proto_init() }
@@ -460,7 +1452,7 @@ func file_proto_storage_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_storage_proto_rawDesc), len(file_proto_storage_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   8,
+			NumMessages:   22,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -0,0 +1,18 @@
+// Which failed storage RPCs are worth retrying, shared by the coordinator and
+// the web servers
+
+package retry
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Retryable reports whether a failed RPC may succeed if tried again.
+func Retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Consistent hashing ring shared by the coordinator and the web servers
+
+package ring
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// Node is a storage server placed on the ring at the hash of its address.
+type Node struct {
+	Addr string
+	Hash uint64
+}
+
+// Ring is an immutable snapshot of the cluster membership, sorted by hash.
+// Version increases every time the coordinator changes the membership.
+type Ring struct {
+	Version uint64
+	Nodes   []Node
+}
+
+var ErrNoNodes = errors.New("no live nodes")
+
+func New(version uint64, addrs []string) *Ring {
+	nodes := make([]Node, 0, len(addrs))
+	for _, addr := range addrs {
+		nodes = append(nodes, Node{Addr: addr, Hash: HashStringToUint64(addr)})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Hash < nodes[j].Hash
+	})
+	return &Ring{Version: version, Nodes: nodes}
+}
+
+// Addrs returns the node addresses in ring order.
+func (r *Ring) Addrs() []string {
+	addrs := make([]string, 0, len(r.Nodes))
+	for _, node := range r.Nodes {
+		addrs = append(addrs, node.Addr)
+	}
+	return addrs
+}
+
+// NodeForHash returns the first node whose hash is greater than hash,
+// wrapping around to the first node of the ring.
+func (r *Ring) NodeForHash(hash uint64) (Node, error) {
+	if len(r.Nodes) == 0 {
+		return Node{}, ErrNoNodes
+	}
+	for _, node := range r.Nodes {
+		if node.Hash > hash {
+			return node, nil
+		}
+	}
+	return r.Nodes[0], nil
+}
+
+// Shares returns the fraction of the hash space each node owns, keyed by
+// address. A node owns the keys hashing from its predecessor's hash up to
+// its own.
+func (r *Ring) Shares() map[string]float64 {
+	shares := make(map[string]float64, len(r.Nodes))
+	if len(r.Nodes) == 1 {
+		shares[r.Nodes[0].Addr] = 1
+		return shares
+	}
+	for i, node := range r.Nodes {
+		prev := r.Nodes[(i+len(r.Nodes)-1)%len(r.Nodes)]
+		// uint64 subtraction wraps around for the first node
+		shares[node.Addr] = float64(node.Hash-prev.Hash) / (1 << 64)
+	}
+	return shares
+}
+
+// NodeForKey returns the owner of a "<videoId>/<filename>" key.
+func (r *Ring) NodeForKey(key string) (Node, error) {
+	return r.NodeForHash(HashStringToUint64(key))
+}
+
+func HashStringToUint64(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,119 @@
+// Crash-safe writes: temp file, fsync, rename, directory fsync
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// temp files are hidden and named .<file>.tmp-<random> next to their target
+const tempMarker = ".tmp-"
+
+// the file operations of a crash-safe write, swapped out by tests to make
+// them fail partway
+var (
+	writeData  = (*os.File).Write
+	syncFile   = (*os.File).Sync
+	renameFile = os.Rename
+)
+
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempMarker)
+}
+
+// isDataFile reports whether name in a video directory is a stored file, as
+// opposed to a checksum sidecar or an unfinished write.
+func isDataFile(name string) bool {
+	return !isChecksumFile(name) && !isTempFile(name)
+}
+
+// writeTemp writes data to a new temp file next to target and fsyncs it.
+// Nothing is visible under target until the temp file is renamed onto it.
+func writeTemp(target string, data []byte) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+tempMarker+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for %s: %w", target, err)
+	}
+	n, err := writeData(f, data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		err = syncFile(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write temp file for %s: %w", target, err)
+	}
+	return f.Name(), nil
+}
+
+// writeFileAtomic replaces path with data so that readers and crashes see
+// either the old contents or the new ones, never a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := writeTemp(path, data)
+	if err != nil {
+		return err
+	}
+	if err := renameFile(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename %s into place: %w", path, err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir fsyncs dir so that renames and new entries in it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// removeTempFiles deletes the temp files of writes interrupted by a crash.
+func removeTempFiles(baseDir string) error {
+	videoDirs, err := os.ReadDir(baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to read base directory %s: %w", baseDir, err)
+	}
+	removed := 0
+	for _, videoDir := range videoDirs {
+		if !videoDir.IsDir() {
+			continue
+		}
+		dir := filepath.Join(baseDir, videoDir.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || !isTempFile(file.Name()) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+				return fmt.Errorf("failed to remove temp file: %w", err)
+			}
+			removed++
+		}
+	}
+	if removed > 0 {
+		slog.Info("Removed temp files left by interrupted writes", "files", removed)
+	}
+	return nil
+}
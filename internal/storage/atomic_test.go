@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errInjected = errors.New("injected failure")
+
+// inject replaces one of the file operation hooks for the rest of the test.
+func inject[T any](t *testing.T, hook *T, fn T) {
+	orig := *hook
+	*hook = fn
+	t.Cleanup(func() { *hook = orig })
+}
+
+// failures are the ways a crash-safe write can fail partway, each making
+// writes to target fail.
+var failures = map[string]func(t *testing.T, target string){
+	"short write": func(t *testing.T, target string) {
+		inject(t, &writeData, func(f *os.File, data []byte) (int, error) {
+			if isTempFor(f.Name(), target) {
+				return f.Write(data[:len(data)/2])
+			}
+			return f.Write(data)
+		})
+	},
+	"fsync": func(t *testing.T, target string) {
+		inject(t, &syncFile, func(f *os.File) error {
+			if isTempFor(f.Name(), target) {
+				return errInjected
+			}
+			return f.Sync()
+		})
+	},
+	"rename": func(t *testing.T, target string) {
+		inject(t, &renameFile, func(oldpath, newpath string) error {
+			if newpath == target {
+				return errInjected
+			}
+			return os.Rename(oldpath, newpath)
+		})
+	},
+}
+
+// isTempFor reports whether name is a temp file written for target.
+func isTempFor(name string, target string) bool {
+	return filepath.Dir(name) == filepath.Dir(target) && strings.HasPrefix(filepath.Base(name), "."+filepath.Base(target)+tempMarker)
+}
+
+// tempFiles returns the names of the temp files in dir.
+func tempFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if isTempFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestWriteFileAtomicFailureKeepsOldContents(t *testing.T) {
+	for name, fail := range failures {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "manifest.mpd")
+			if err := os.WriteFile(path, []byte("old contents"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fail(t, path)
+
+			if err := writeFileAtomic(path, []byte("new contents, longer than the old")); err == nil {
+				t.Fatal("write succeeded despite the injected failure")
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "old contents" {
+				t.Errorf("file holds %q after a failed write, want the old contents", data)
+			}
+			if left := tempFiles(t, dir); len(left) > 0 {
+				t.Errorf("failed write left temp files %v", left)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomicFailureLeavesNoFile(t *testing.T) {
+	for name, fail := range failures {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "manifest.mpd")
+			fail(t, path)
+
+			if err := writeFileAtomic(path, []byte("new contents")); err == nil {
+				t.Fatal("write succeeded despite the injected failure")
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("file exists after a failed write of a new file (stat error %v)", err)
+			}
+			if left := tempFiles(t, dir); len(left) > 0 {
+				t.Errorf("failed write left temp files %v", left)
+			}
+		})
+	}
+}
+
+func TestFSBackendWriteFailureKeepsOldFile(t *testing.T) {
+	for name, fail := range failures {
+		t.Run(name, func(t *testing.T) {
+			b, err := NewFSBackend(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			old := []byte("old segment")
+			oldSum := sha256.Sum256(old)
+			if err := b.Write("vid/chunk.m4s", old, oldSum[:]); err != nil {
+				t.Fatal(err)
+			}
+			fail(t, b.filePath("vid/chunk.m4s"))
+
+			data := []byte("new segment, longer than the old one")
+			sum := sha256.Sum256(data)
+			if err := b.Write("vid/chunk.m4s", data, sum[:]); err == nil {
+				t.Fatal("write succeeded despite the injected failure")
+			}
+			got, gotSum, err := b.Read("vid/chunk.m4s")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, old) || !bytes.Equal(gotSum, oldSum[:]) {
+				t.Errorf("read %q with checksum %x after a failed write, want the old file", got, gotSum)
+			}
+			if left := tempFiles(t, filepath.Dir(b.filePath("vid/chunk.m4s"))); len(left) > 0 {
+				t.Errorf("failed write left temp files %v", left)
+			}
+		})
+	}
+}
+
+// A failed sidecar rename comes after the data is already in place, so the
+// old data has to be put back.
+func TestFSBackendChecksumRenameFailureRestoresOldFile(t *testing.T) {
+	b, err := NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	old := []byte("old segment")
+	oldSum := sha256.Sum256(old)
+	if err := b.Write("vid/chunk.m4s", old, oldSum[:]); err != nil {
+		t.Fatal(err)
+	}
+	failures["rename"](t, b.filePath("vid/chunk.m4s")+checksumSuffix)
+
+	data := []byte("new segment")
+	sum := sha256.Sum256(data)
+	if err := b.Write("vid/chunk.m4s", data, sum[:]); err == nil {
+		t.Fatal("write succeeded despite the injected failure")
+	}
+	got, gotSum, err := b.Read("vid/chunk.m4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, old) || !bytes.Equal(gotSum, oldSum[:]) {
+		t.Errorf("read %q with checksum %x after a failed write, want the old file", got, gotSum)
+	}
+}
+
+func TestStartupRemovesTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("segment")
+	sum := sha256.Sum256(data)
+	if err := b.Write("vid/chunk.m4s", data, sum[:]); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	// a write that crashed before its rename, and one that crashed between
+	// keeping the old version and committing
+	path := filepath.Join(dir, "vid", "chunk.m4s")
+	tmp, err := writeTemp(path, []byte("half a new segm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path, tmp+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeTemp(filepath.Join(dir, "vid", "other.m4s"), []byte("never renamed")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if left := tempFiles(t, filepath.Join(dir, "vid")); len(left) > 0 {
+		t.Errorf("startup left temp files %v", left)
+	}
+	got, _, err := b.Read("vid/chunk.m4s")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("read %q, %v after startup, want the committed file", got, err)
+	}
+	infos, _, err := b.List(ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name != "vid/chunk.m4s" {
+		t.Errorf("listed %v after startup, want only vid/chunk.m4s", infos)
+	}
+}
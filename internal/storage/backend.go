@@ -0,0 +1,55 @@
+// Storage engines behind StorageService
+
+package storage
+
+import (
+	"io"
+	"time"
+	pb "tritontube/internal/proto"
+)
+
+const (
+	BackendFS   = "fs"   // one file per segment under <baseDir>/<videoId>/
+	BackendPack = "pack" // append-only pack files with an on-disk index
+)
+
+// FileStat describes a stored file.
+type FileStat struct {
+	Size    int64
+	ModTime time.Time
+	Sum     []byte // SHA-256 stored with the file, nil if it has none
+}
+
+// Backend stores the files of one storage node. Files are named
+// "<videoId>/<fileName>" and stored with the SHA-256 they were written with.
+// Errors for files that do not exist wrap os.ErrNotExist.
+type Backend interface {
+	// Read returns the file and its stored checksum, nil if it has none.
+	Read(name string) ([]byte, []byte, error)
+	// Open returns a reader of the file, which the caller must close, along
+	// with its size, write time and checksum.
+	Open(name string) (io.ReadSeekCloser, FileStat, error)
+	// Write atomically replaces the file and its checksum.
+	Write(name string, data []byte, sum []byte) error
+	Remove(name string) error
+	// Stat returns a file's size, write time and checksum without reading it.
+	Stat(name string) (FileStat, error)
+	// DeleteVideo removes every file of a video and returns how many there were.
+	DeleteVideo(videoId string) (int, error)
+	// List returns the files matching opts in name order, and the page
+	// token of the rest if opts.PageSize cut the listing short.
+	List(opts ListOptions) ([]*pb.FileInfo, string, error)
+	// BeginBatch starts a set of writes that take effect together.
+	BeginBatch() (Batch, error)
+	// Verify reports whether the file still matches its checksum.
+	Verify(name string) (bool, error)
+	Close() error
+}
+
+// Batch stages writes until Commit puts all of them in place. If Add or
+// Commit fails, or Abort is called, none of them take effect.
+type Batch interface {
+	Add(name string, data []byte, sum []byte) error
+	Commit() error
+	Abort()
+}
@@ -0,0 +1,109 @@
+// SHA-256 sidecar files and the background scrubber
+
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// the checksum of <file> is stored as hex in <file>.sha256 next to it
+const checksumSuffix = ".sha256"
+
+func isChecksumFile(name string) bool {
+	return strings.HasSuffix(name, checksumSuffix)
+}
+
+// readChecksum returns the stored checksum of filePath, or nil if the file
+// was written before checksums were kept.
+func readChecksum(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath + checksumSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checksum of %s: %w", filePath, err)
+	}
+	sum, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("invalid checksum file for %s", filePath)
+	}
+	return sum, nil
+}
+
+func writeChecksum(filePath string, sum []byte) error {
+	if err := writeFileAtomic(filePath+checksumSuffix, encodeChecksum(sum)); err != nil {
+		return fmt.Errorf("failed to write checksum of %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// encodeChecksum returns the contents of a sidecar holding sum.
+func encodeChecksum(sum []byte) []byte {
+	return []byte(hex.EncodeToString(sum) + "\n")
+}
+
+func removeChecksum(filePath string) error {
+	if err := os.Remove(filePath + checksumSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove checksum of %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// StartScrubber re-hashes every stored file each interval and logs the ones
+// that no longer match their checksum. Stats reports them until a later scrub
+// finds them intact.
+func (ss *StorageService) StartScrubber(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			ss.scrub()
+		}
+	}()
+}
+
+func (ss *StorageService) scrub() {
+	start := time.Now()
+	checked := 0
+	corrupt := make([]string, 0)
+	infos, _, err := ss.backend.List(ListOptions{})
+	if err != nil {
+		slog.Error("Scrub failed to list files", "error", err)
+		return
+	}
+	for _, info := range infos {
+		ok, err := ss.backend.Verify(info.Name)
+		if err != nil {
+			// most likely removed since List
+			slog.Warn("Scrub skipping file", "file", info.Name, "error", err)
+			continue
+		}
+		checked++
+		if !ok {
+			slog.Error("CORRUPT: file does not match its checksum", "file", info.Name)
+			corrupt = append(corrupt, info.Name)
+		}
+	}
+
+	ss.scrubMu.Lock()
+	ss.corrupt = corrupt
+	ss.lastScrub = time.Now()
+	ss.scrubMu.Unlock()
+	slog.Info("Scrub finished", "checked", checked, "corrupt", len(corrupt), "duration", time.Since(start).Round(time.Millisecond))
+}
+
+// scrubReport returns the corrupt files found by the last scrub and when it
+// finished, in Unix milliseconds.
+func (ss *StorageService) scrubReport() ([]string, int64) {
+	ss.scrubMu.Lock()
+	defer ss.scrubMu.Unlock()
+	if ss.lastScrub.IsZero() {
+		return nil, 0
+	}
+	return append([]string(nil), ss.corrupt...), ss.lastScrub.UnixMilli()
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package storage
+
+// freeDiskSpace is not supported on this platform; Stats reports 0.
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package storage
+
+import "syscall"
+
+// freeDiskSpace returns the bytes available to this process on the disk holding dir.
+func freeDiskSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,625 @@
+// Plain filesystem backend: <baseDir>/<videoId>/<fileName>
+
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	pb "tritontube/internal/proto"
+)
+
+// indexSnapshot holds the file index as of the last compaction, ending in
+// a line with the number of files so a truncated snapshot is not trusted.
+const indexSnapshot = ".index"
+
+// indexJournal names the files changed since the snapshot, one quoted name
+// (or video id, for DeleteVideo) per line. A name is fsynced to the journal
+// before its file changes, so after a crash the snapshot and a fresh stat of
+// every journaled name make up the index.
+const indexJournal = ".index.journal"
+
+// journalCompactLines is how long the journal grows before the index is
+// snapshotted again and the journal emptied.
+const journalCompactLines = 10000
+
+type FSBackend struct {
+	baseDir string
+
+	mu    sync.RWMutex
+	index *fileIndex
+
+	// changeMu is held shared by each change from journaling it until the
+	// index is updated, and exclusively while compacting
+	changeMu     sync.RWMutex
+	journalMu    sync.Mutex
+	journal      *os.File
+	journalLines int
+}
+
+// NewFSBackend stores files under baseDir, removing the temp files of writes
+// interrupted by a crash.
+func NewFSBackend(baseDir string) (*FSBackend, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create base directory %s: %w", baseDir, err)
+	}
+	if err := removeTempFiles(baseDir); err != nil {
+		return nil, err
+	}
+	b := &FSBackend{baseDir: baseDir}
+	index, err := loadIndexSnapshot(filepath.Join(baseDir, indexSnapshot))
+	if err == nil {
+		err = b.replayIndexJournal(index)
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Ignoring index snapshot", "error", err)
+		}
+		start := time.Now()
+		if index, err = b.walk(); err != nil {
+			return nil, err
+		}
+		slog.Info("Indexed files", "files", index.count, "dir", baseDir, "duration", time.Since(start).Round(time.Millisecond))
+	}
+	b.index = index
+	b.journal, err = os.OpenFile(filepath.Join(baseDir, indexJournal), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index journal: %w", err)
+	}
+	// start from a snapshot of what was just loaded and an empty journal
+	if err := b.compact(); err != nil {
+		b.journal.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *FSBackend) filePath(name string) string {
+	return filepath.Join(b.baseDir, filepath.FromSlash(name))
+}
+
+func (b *FSBackend) Read(name string) ([]byte, []byte, error) {
+	filePath := b.filePath(name)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			slog.Debug("File not found", "path", filePath)
+			return nil, nil, fmt.Errorf("file not found: %w", err)
+		}
+		return nil, nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	sum, err := readChecksum(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, sum, nil
+}
+
+func (b *FSBackend) Open(name string) (io.ReadSeekCloser, FileStat, error) {
+	filePath := b.filePath(name)
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, FileStat{}, fmt.Errorf("file not found: %w", err)
+		}
+		return nil, FileStat{}, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	// a write replaces the file by renaming over it, so the open file keeps
+	// the old contents; the checksum is read after opening to match them
+	// unless the write lands in between
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", filePath)
+	}
+	if err != nil {
+		f.Close()
+		return nil, FileStat{}, fmt.Errorf("failed to stat file %s: %w", filePath, err)
+	}
+	sum, err := readChecksum(filePath)
+	if err != nil {
+		f.Close()
+		return nil, FileStat{}, err
+	}
+	return f, FileStat{Size: info.Size(), ModTime: info.ModTime(), Sum: sum}, nil
+}
+
+func (b *FSBackend) Write(name string, data []byte, sum []byte) error {
+	batch, err := b.BeginBatch()
+	if err != nil {
+		return err
+	}
+	if err := batch.Add(name, data, sum); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
+
+// fsBatch stages each file and its checksum in fsynced temp files next to
+// their targets, and renames them all into place on Commit.
+type fsBatch struct {
+	b      *FSBackend
+	staged []stagedFile
+	dirs   []string // video directories created for the batch
+}
+
+type stagedFile struct {
+	name    string
+	path    string
+	size    int64
+	dataTmp string
+	sumTmp  string
+	oldData string // hard link to the file being replaced, if any
+	oldSum  string // hard link to its sidecar, if any
+}
+
+func (b *FSBackend) BeginBatch() (Batch, error) {
+	return &fsBatch{b: b}, nil
+}
+
+func (batch *fsBatch) Add(name string, data []byte, sum []byte) error {
+	filePath := batch.b.filePath(name)
+	videoDir := filepath.Dir(filePath)
+
+	_, statErr := os.Stat(videoDir)
+	if err := os.MkdirAll(videoDir, 0755); err != nil {
+		batch.Abort()
+		return fmt.Errorf("failed to create video directory %s: %w", videoDir, err)
+	}
+	if os.IsNotExist(statErr) {
+		batch.dirs = append(batch.dirs, videoDir)
+		// make the new video directory itself durable
+		if err := syncDir(batch.b.baseDir); err != nil {
+			batch.Abort()
+			return err
+		}
+	}
+
+	dataTmp, err := writeTemp(filePath, data)
+	if err != nil {
+		batch.Abort()
+		return err
+	}
+	sumTmp, err := writeTemp(filePath+checksumSuffix, encodeChecksum(sum))
+	if err != nil {
+		os.Remove(dataTmp)
+		batch.Abort()
+		return err
+	}
+	batch.staged = append(batch.staged, stagedFile{name: name, path: filePath, size: int64(len(data)), dataTmp: dataTmp, sumTmp: sumTmp})
+	return nil
+}
+
+// Commit renames every staged file into place. The current version of each
+// file being replaced is hard linked aside first, so readers never find it
+// missing, and if a rename fails every file of the batch is put back the way
+// it was. The old sidecar goes before the data is renamed, so a crash in
+// between leaves a file with no checksum (filled in by the next scrub) rather
+// than one that fails it.
+func (batch *fsBatch) Commit() error {
+	b := batch.b
+	b.changeMu.RLock()
+	names := make([]string, 0, len(batch.staged))
+	for _, f := range batch.staged {
+		names = append(names, f.name)
+	}
+	if err := b.journalChange(names...); err != nil {
+		b.changeMu.RUnlock()
+		batch.Abort()
+		return err
+	}
+	for i := range batch.staged {
+		if err := batch.staged[i].keepOld(); err != nil {
+			b.changeMu.RUnlock()
+			batch.Abort()
+			return err
+		}
+	}
+	dirs := make(map[string]bool)
+	for i, f := range batch.staged {
+		err := removeChecksum(f.path)
+		if err == nil {
+			err = renameFile(f.dataTmp, f.path)
+		}
+		if err == nil {
+			err = renameFile(f.sumTmp, f.path+checksumSuffix)
+		}
+		if err != nil {
+			for j := range batch.staged[:i+1] {
+				batch.staged[j].restoreOld()
+			}
+			b.changeMu.RUnlock()
+			batch.Abort()
+			return fmt.Errorf("failed to write file %s: %w", f.path, err)
+		}
+		dirs[filepath.Dir(f.path)] = true
+	}
+	b.mu.Lock()
+	for _, f := range batch.staged {
+		b.index.put(f.name, f.size)
+	}
+	b.mu.Unlock()
+	b.changeMu.RUnlock()
+	b.compactIfLong()
+	for _, f := range batch.staged {
+		f.dropOld()
+	}
+	batch.staged = nil
+	batch.dirs = nil
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (batch *fsBatch) Abort() {
+	for _, f := range batch.staged {
+		os.Remove(f.dataTmp)
+		os.Remove(f.sumTmp)
+		f.dropOld()
+	}
+	batch.staged = nil
+	// only removed if nothing else was written to them meanwhile
+	for _, dir := range batch.dirs {
+		os.Remove(dir)
+	}
+	batch.dirs = nil
+}
+
+// keepOld hard links the file being replaced and its sidecar, if they
+// exist, next to the temp files. The links are temp files themselves, so a
+// crash leaves nothing behind that startup does not clean up.
+func (f *stagedFile) keepOld() error {
+	oldData, oldSum := f.dataTmp+".old", f.sumTmp+".old"
+	if err := os.Link(f.path, oldData); err == nil {
+		f.oldData = oldData
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to keep the old version of %s: %w", f.path, err)
+	}
+	if err := os.Link(f.path+checksumSuffix, oldSum); err == nil {
+		f.oldSum = oldSum
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to keep the old checksum of %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// restoreOld puts back the version of the file kept by keepOld, or removes
+// the file if there was none. Afterwards dropOld has nothing left to remove:
+// a link that could not be put back is kept, and logged, for the operator.
+func (f *stagedFile) restoreOld() {
+	if f.oldData == "" {
+		os.Remove(f.path)
+	} else {
+		restoreLink(f.oldData, f.path)
+	}
+	if f.oldSum == "" {
+		removeChecksum(f.path)
+	} else {
+		restoreLink(f.oldSum, f.path+checksumSuffix)
+	}
+	f.oldData, f.oldSum = "", ""
+}
+
+// restoreLink renames the hard link kept onto path. If path was never
+// replaced the two are the same file and rename leaves both, so the link is
+// removed separately.
+func restoreLink(kept string, path string) {
+	if err := os.Rename(kept, path); err != nil {
+		slog.Error("Failed to restore the old version of a file", "path", path, "kept", kept, "error", err)
+		return
+	}
+	os.Remove(kept)
+}
+
+func (f *stagedFile) dropOld() {
+	if f.oldData != "" {
+		os.Remove(f.oldData)
+	}
+	if f.oldSum != "" {
+		os.Remove(f.oldSum)
+	}
+}
+
+func (b *FSBackend) Remove(name string) error {
+	filePath := b.filePath(name)
+	b.changeMu.RLock()
+	if err := b.journalChange(name); err != nil {
+		b.changeMu.RUnlock()
+		return err
+	}
+	if err := os.Remove(filePath); err != nil {
+		b.changeMu.RUnlock()
+		return err
+	}
+	b.mu.Lock()
+	b.index.remove(name)
+	b.mu.Unlock()
+	b.changeMu.RUnlock()
+	b.compactIfLong()
+	return removeChecksum(filePath)
+}
+
+func (b *FSBackend) Stat(name string) (FileStat, error) {
+	filePath := b.filePath(name)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return FileStat{}, err
+	}
+	sum, err := readChecksum(filePath)
+	if err != nil {
+		return FileStat{}, err
+	}
+	return FileStat{Size: info.Size(), ModTime: info.ModTime(), Sum: sum}, nil
+}
+
+// DeleteVideo removes the video's directory along with everything in it.
+func (b *FSBackend) DeleteVideo(videoId string) (int, error) {
+	videoDir := b.filePath(videoId)
+	if filepath.Dir(videoDir) != filepath.Clean(b.baseDir) {
+		return 0, fmt.Errorf("invalid video id %q", videoId)
+	}
+	b.changeMu.RLock()
+	if err := b.journalChange(videoId); err != nil {
+		b.changeMu.RUnlock()
+		return 0, err
+	}
+	b.mu.Lock()
+	names := b.index.videoFiles(videoId)
+	for _, name := range names {
+		b.index.remove(name)
+	}
+	b.mu.Unlock()
+	err := os.RemoveAll(videoDir)
+	b.changeMu.RUnlock()
+	b.compactIfLong()
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove video directory %s: %w", videoDir, err)
+	}
+	return len(names), syncDir(b.baseDir)
+}
+
+func (b *FSBackend) List(opts ListOptions) ([]*pb.FileInfo, string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	infos, next := b.index.list(opts)
+	return infos, next, nil
+}
+
+// walk builds the index from the directory tree.
+func (b *FSBackend) walk() (*fileIndex, error) {
+	index := newFileIndex()
+
+	entries, err := os.ReadDir(b.baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := b.walkVideo(index, entry.Name()); err != nil {
+				slog.Warn("Skipping unreadable directory", "dir", b.filePath(entry.Name()), "error", err)
+			}
+		}
+	}
+	return index, nil
+}
+
+// walkVideo adds the files in a video's directory to index.
+func (b *FSBackend) walkVideo(index *fileIndex, videoId string) error {
+	entries, err := os.ReadDir(b.filePath(videoId))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && isDataFile(entry.Name()) {
+			info, err := entry.Info()
+			if err != nil {
+				// removed since ReadDir
+				continue
+			}
+			index.put(path.Join(videoId, entry.Name()), info.Size())
+		}
+	}
+	return nil
+}
+
+// Verify re-hashes the file. Files written before checksums were kept get one.
+func (b *FSBackend) Verify(name string) (bool, error) {
+	filePath := b.filePath(name)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	want, err := readChecksum(filePath)
+	if err != nil {
+		// an unreadable checksum cannot vouch for the file either
+		slog.Warn("Unreadable checksum", "file", name, "error", err)
+		return false, nil
+	}
+	if want == nil {
+		return true, writeChecksum(filePath, sum[:])
+	}
+	return bytes.Equal(want, sum[:]), nil
+}
+
+// Close saves the index so the next start does not have to replay the
+// journal.
+func (b *FSBackend) Close() error {
+	err := b.compact()
+	b.journal.Close()
+	return err
+}
+
+// journalChange records that the named files, or whole videos, are about to
+// change.
+func (b *FSBackend) journalChange(names ...string) error {
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(strconv.Quote(name))
+		buf.WriteByte('\n')
+	}
+	b.journalMu.Lock()
+	defer b.journalMu.Unlock()
+	if _, err := b.journal.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to journal index change: %w", err)
+	}
+	if err := b.journal.Sync(); err != nil {
+		return fmt.Errorf("failed to journal index change: %w", err)
+	}
+	b.journalLines += len(names)
+	return nil
+}
+
+func (b *FSBackend) compactIfLong() {
+	b.journalMu.Lock()
+	long := b.journalLines >= journalCompactLines
+	b.journalMu.Unlock()
+	if long {
+		if err := b.compact(); err != nil {
+			slog.Warn("Failed to compact index journal", "error", err)
+		}
+	}
+}
+
+// compact snapshots the index and empties the journal. A crash in between
+// only replays changes the snapshot already has.
+func (b *FSBackend) compact() error {
+	b.changeMu.Lock()
+	defer b.changeMu.Unlock()
+	b.mu.RLock()
+	err := saveIndexSnapshot(filepath.Join(b.baseDir, indexSnapshot), b.index)
+	b.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	b.journalMu.Lock()
+	defer b.journalMu.Unlock()
+	if err := b.journal.Truncate(0); err != nil {
+		return fmt.Errorf("failed to empty index journal: %w", err)
+	}
+	if err := b.journal.Sync(); err != nil {
+		return fmt.Errorf("failed to empty index journal: %w", err)
+	}
+	b.journalLines = 0
+	return nil
+}
+
+// replayIndexJournal brings a snapshot up to date by checking every file
+// named in the journal on disk. A torn last line is a change that never
+// started, since nothing changes until its name is synced.
+func (b *FSBackend) replayIndexJournal(index *fileIndex) error {
+	data, err := os.ReadFile(filepath.Join(b.baseDir, indexJournal))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read index journal: %w", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	changed := make(map[string]bool)
+	// the last element is empty, or the torn line
+	for _, line := range lines[:len(lines)-1] {
+		name, err := strconv.Unquote(line)
+		if err != nil {
+			return fmt.Errorf("bad index journal line %q: %w", line, err)
+		}
+		changed[name] = true
+	}
+	for name := range changed {
+		if !strings.Contains(name, "/") {
+			// a deleted video, which may have been written to again since
+			for _, fileName := range index.videoFiles(name) {
+				index.remove(fileName)
+			}
+			if err := b.walkVideo(index, name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		info, err := os.Stat(b.filePath(name))
+		switch {
+		case err == nil && !info.IsDir():
+			index.put(name, info.Size())
+		case err == nil || os.IsNotExist(err):
+			index.remove(name)
+		default:
+			return err
+		}
+	}
+	if len(changed) > 0 {
+		slog.Info("Replayed index journal", "files", len(changed))
+	}
+	return nil
+}
+
+// The snapshot has one quoted file name and its size per line, then the
+// number of files.
+func saveIndexSnapshot(snapshotPath string, index *fileIndex) error {
+	var buf bytes.Buffer
+	infos, _ := index.list(ListOptions{})
+	for _, info := range infos {
+		fmt.Fprintf(&buf, "%s %d\n", strconv.Quote(info.Name), info.Size)
+	}
+	fmt.Fprintf(&buf, "end %d\n", len(infos))
+	if err := writeFileAtomic(snapshotPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to save index snapshot: %w", err)
+	}
+	return nil
+}
+
+func loadIndexSnapshot(snapshotPath string) (*fileIndex, error) {
+	f, err := os.Open(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	index := newFileIndex()
+	scanner := bufio.NewScanner(f)
+	ended := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if ended {
+			return nil, fmt.Errorf("index snapshot continues after its end: %q", line)
+		}
+		if count, ok := strings.CutPrefix(line, "end "); ok {
+			if count != strconv.Itoa(index.count) {
+				return nil, fmt.Errorf("index snapshot ends at %s files but has %d", count, index.count)
+			}
+			ended = true
+			continue
+		}
+		sep := strings.LastIndexByte(line, ' ')
+		if sep < 0 {
+			return nil, fmt.Errorf("bad index snapshot line %q", line)
+		}
+		name, err := strconv.Unquote(line[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("bad index snapshot line %q: %w", line, err)
+		}
+		size, err := strconv.ParseInt(line[sep+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad index snapshot line %q: %w", line, err)
+		}
+		index.put(name, size)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read index snapshot: %w", err)
+	}
+	if !ended {
+		return nil, fmt.Errorf("index snapshot is truncated")
+	}
+	return index, nil
+}
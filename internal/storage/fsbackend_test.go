@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, b Backend, name string, data string) {
+	sum := sha256.Sum256([]byte(data))
+	if err := b.Write(name, []byte(data), sum[:]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listSizes returns the size of every file b lists, by name.
+func listSizes(t *testing.T, b Backend) map[string]int64 {
+	infos, _, err := b.List(ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make(map[string]int64)
+	for _, info := range infos {
+		sizes[info.Name] = info.Size
+	}
+	return sizes
+}
+
+func sameSizes(got map[string]int64, want map[string]int64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for name, size := range want {
+		if got[name] != size {
+			return false
+		}
+	}
+	return true
+}
+
+// A backend that is never closed still comes back with every change made
+// since its snapshot.
+func TestFSBackendIndexSurvivesCrash(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, b, "vid/manifest.mpd", "manifest")
+	writeFile(t, b, "vid/chunk.m4s", "segment")
+	writeFile(t, b, "gone/chunk.m4s", "segment")
+	writeFile(t, b, "other/chunk.m4s", "segment")
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, b, "vid/manifest.mpd", "longer manifest")
+	writeFile(t, b, "new/chunk.m4s", "new segment")
+	if err := b.Remove("vid/chunk.m4s"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.DeleteVideo("gone"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, b, "gone/again.m4s", "segment")
+	want := listSizes(t, b)
+	// crash: no Close
+
+	b, err = NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if got := listSizes(t, b); !sameSizes(got, want) {
+		t.Errorf("listed %v after a crash, want %v", got, want)
+	}
+}
+
+func TestFSBackendIgnoresTruncatedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, b, "vid/manifest.mpd", "manifest")
+	writeFile(t, b, "vid/chunk.m4s", "segment")
+	want := listSizes(t, b)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := filepath.Join(dir, indexSnapshot)
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep only the first file
+	if err := os.WriteFile(snapshot, data[:bytes.IndexByte(data, '\n')+1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err = NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if got := listSizes(t, b); !sameSizes(got, want) {
+		t.Errorf("listed %v from a truncated snapshot, want %v", got, want)
+	}
+}
+
+// A batch that fails to commit partway leaves every file as it was, including
+// the ones it had already replaced.
+func TestFSBatchCommitFailureRestoresReplacedFiles(t *testing.T) {
+	b, err := NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	old := map[string][]byte{
+		"vid/manifest.mpd":    []byte("old manifest"),
+		"vid/chunk-0-001.m4s": []byte("old segment"),
+	}
+	for name, data := range old {
+		sum := sha256.Sum256(data)
+		if err := b.Write(name, data, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	batch, err := b.BeginBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"vid/manifest.mpd", "vid/new.m4s", "vid/chunk-0-001.m4s"} {
+		data := []byte("new " + name)
+		sum := sha256.Sum256(data)
+		if err := batch.Add(name, data, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the last file fails after the first two are in place
+	failures["rename"](t, b.filePath("vid/chunk-0-001.m4s"))
+	if err := batch.Commit(); err == nil {
+		t.Fatal("commit succeeded despite the injected failure")
+	}
+
+	for name, data := range old {
+		got, sum, err := b.Read(name)
+		want := sha256.Sum256(data)
+		if err != nil || !bytes.Equal(got, data) || !bytes.Equal(sum, want[:]) {
+			t.Errorf("read %s = %q, %x, %v after a failed commit, want the old file", name, got, sum, err)
+		}
+	}
+	if _, _, err := b.Read("vid/new.m4s"); err == nil {
+		t.Error("file added by a failed commit is readable")
+	}
+	infos, _, err := b.List(ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != len(old) {
+		t.Errorf("listed %v after a failed commit, want only the old files", infos)
+	}
+	for _, info := range infos {
+		if int64(len(old[info.Name])) != info.Size {
+			t.Errorf("listed %s with size %d, want %d", info.Name, info.Size, len(old[info.Name]))
+		}
+	}
+	if left := tempFiles(t, filepath.Dir(b.filePath("vid/new.m4s"))); len(left) > 0 {
+		t.Errorf("failed commit left temp files %v", left)
+	}
+}
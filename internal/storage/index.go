@@ -0,0 +1,136 @@
+// In-memory index of a node's files, used to list them without a disk walk
+
+package storage
+
+import (
+	"path"
+	"sort"
+	"strings"
+	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
+)
+
+// ListOptions filters and pages a Backend listing; see ListRequest.
+type ListOptions struct {
+	Prefix    string
+	HashRange bool
+	HashStart uint64
+	HashEnd   uint64
+	PageSize  int // 0 for no limit
+	PageToken string
+}
+
+func (o ListOptions) matchesHash(hash uint64) bool {
+	if !o.HashRange {
+		return true
+	}
+	if o.HashStart < o.HashEnd {
+		return hash > o.HashStart && hash <= o.HashEnd
+	}
+	// wraps around the top of the ring
+	return hash > o.HashStart || hash <= o.HashEnd
+}
+
+type indexEntry struct {
+	size int64
+	hash uint64 // ring hash of the "<videoId>/<fileName>" key
+}
+
+// fileIndex holds every file by video, with the video ids kept sorted so a
+// listing can seek to a prefix or page token. It is not safe for concurrent
+// use; backends guard it with their own lock.
+type fileIndex struct {
+	videos   map[string]map[string]indexEntry
+	videoIds []string
+	count    int
+}
+
+func newFileIndex() *fileIndex {
+	return &fileIndex{videos: make(map[string]map[string]indexEntry)}
+}
+
+func (idx *fileIndex) put(name string, size int64) {
+	videoId, fileName := path.Split(name)
+	videoId = strings.TrimSuffix(videoId, "/")
+	files, ok := idx.videos[videoId]
+	if !ok {
+		files = make(map[string]indexEntry)
+		idx.videos[videoId] = files
+		i := sort.SearchStrings(idx.videoIds, videoId)
+		idx.videoIds = append(idx.videoIds, "")
+		copy(idx.videoIds[i+1:], idx.videoIds[i:])
+		idx.videoIds[i] = videoId
+	}
+	if _, ok := files[fileName]; !ok {
+		idx.count++
+	}
+	files[fileName] = indexEntry{size: size, hash: ring.HashStringToUint64(name)}
+}
+
+func (idx *fileIndex) remove(name string) {
+	videoId, fileName := path.Split(name)
+	videoId = strings.TrimSuffix(videoId, "/")
+	files, ok := idx.videos[videoId]
+	if !ok {
+		return
+	}
+	if _, ok := files[fileName]; !ok {
+		return
+	}
+	delete(files, fileName)
+	idx.count--
+	if len(files) == 0 {
+		delete(idx.videos, videoId)
+		i := sort.SearchStrings(idx.videoIds, videoId)
+		idx.videoIds = append(idx.videoIds[:i], idx.videoIds[i+1:]...)
+	}
+}
+
+// videoFiles returns the names of every file of a video.
+func (idx *fileIndex) videoFiles(videoId string) []string {
+	names := make([]string, 0, len(idx.videos[videoId]))
+	for fileName := range idx.videos[videoId] {
+		names = append(names, path.Join(videoId, fileName))
+	}
+	return names
+}
+
+// list returns the files matching opts in name order, and the token of the
+// next page if there is one.
+func (idx *fileIndex) list(opts ListOptions) ([]*pb.FileInfo, string) {
+	infos := make([]*pb.FileInfo, 0)
+	startVideo, after := opts.Prefix, ""
+	if opts.PageToken != "" {
+		tokenVideo, tokenFile := path.Split(opts.PageToken)
+		tokenVideo = strings.TrimSuffix(tokenVideo, "/")
+		if tokenVideo >= startVideo {
+			startVideo, after = tokenVideo, tokenFile
+		}
+	}
+	for i := sort.SearchStrings(idx.videoIds, startVideo); i < len(idx.videoIds); i++ {
+		videoId := idx.videoIds[i]
+		if !strings.HasPrefix(videoId, opts.Prefix) {
+			break
+		}
+		files := idx.videos[videoId]
+		names := make([]string, 0, len(files))
+		for fileName := range files {
+			if videoId == startVideo && after != "" && fileName <= after {
+				continue
+			}
+			names = append(names, fileName)
+		}
+		sort.Strings(names)
+		for _, fileName := range names {
+			entry := files[fileName]
+			if !opts.matchesHash(entry.hash) {
+				continue
+			}
+			if opts.PageSize > 0 && len(infos) == opts.PageSize {
+				return infos, infos[len(infos)-1].Name
+			}
+			infos = append(infos, &pb.FileInfo{Name: path.Join(videoId, fileName), Size: entry.size})
+		}
+	}
+	return infos, ""
+}
@@ -0,0 +1,765 @@
+// Log-structured backend: files are appended to pack files with an index
+
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	pb "tritontube/internal/proto"
+)
+
+// A pack file is a sequence of records:
+//
+//	magic u32 | crc32 u32 | kind u8 | key length u16 | data length u32 | mtime i64 | sha256 [32] | key | data
+//
+// The CRC covers everything after itself, so a record torn by a crash is
+// detected and dropped. A put record stores a file, a delete record removes
+// one, and a compacted record at the start of a pack says the pack holds
+// every live file of the packs before it, which can be discarded.
+const (
+	packMagic        = 0x54545042 // "TTPB"
+	packHeaderSize   = 4 + 4 + 1 + 2 + 4 + 8 + sha256.Size
+	packMaxSize      = 64 << 20 // the active pack is sealed once it grows past this
+	compactThreshold = 0.3      // compact once this fraction of sealed pack bytes is dead
+
+	recordPut       = 1
+	recordDelete    = 2
+	recordCompacted = 3
+)
+
+// packRecord locates one record; offset is where its data starts.
+type packRecord struct {
+	Kind    byte   `json:"kind"`
+	Key     string `json:"key"`
+	Offset  int64  `json:"offset"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // unix nanoseconds of the write
+	Sum     []byte `json:"sum"`
+}
+
+func (r packRecord) recordSize() int64 {
+	return packHeaderSize + int64(len(r.Key)) + r.Size
+}
+
+// packIndex is written next to every sealed pack as pack-<id>.idx, so that
+// opening the backend does not have to read every pack.
+type packIndex struct {
+	PackSize  int64        `json:"pack_size"`
+	Compacted bool         `json:"compacted"`
+	Records   []packRecord `json:"records"`
+}
+
+type pack struct {
+	id   int
+	f    *os.File
+	size int64
+	dead int64        // bytes of records that no longer hold a live file
+	recs []packRecord // records of the active pack, for its index
+}
+
+type packEntry struct {
+	pack int
+	rec  packRecord
+}
+
+type PackBackend struct {
+	dir string
+
+	mu     sync.RWMutex
+	index  map[string]packEntry // live files
+	files  *fileIndex           // the same files, for listing
+	packs  map[int]*pack
+	active *pack
+
+	compactMu sync.Mutex // one compaction at a time
+	stop      chan struct{}
+}
+
+// OpenPackBackend opens the pack files in dir, creating it if needed. Packs
+// left unsealed by the previous run are scanned, a torn last record is
+// dropped, and they are sealed; new files go to a fresh pack.
+func OpenPackBackend(dir string) (*PackBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create pack directory %s: %w", dir, err)
+	}
+	b := &PackBackend{
+		dir:   dir,
+		index: make(map[string]packEntry),
+		files: newFileIndex(),
+		packs: make(map[int]*pack),
+		stop:  make(chan struct{}),
+	}
+	if err := b.load(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	next := 1
+	for id := range b.packs {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	active, err := b.createPack(next)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.active = active
+	return b, nil
+}
+
+func (b *PackBackend) packPath(id int) string {
+	return filepath.Join(b.dir, fmt.Sprintf("pack-%06d.dat", id))
+}
+
+func (b *PackBackend) indexPath(id int) string {
+	return filepath.Join(b.dir, fmt.Sprintf("pack-%06d.idx", id))
+}
+
+// load replays every pack in order into the in-memory index.
+func (b *PackBackend) load() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read pack directory %s: %w", b.dir, err)
+	}
+	ids := make([]int, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if isTempFile(name) {
+			// an interrupted compaction
+			os.Remove(filepath.Join(b.dir, name))
+			continue
+		}
+		if !strings.HasPrefix(name, "pack-") || !strings.HasSuffix(name, ".dat") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "pack-"), ".dat"))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	indexes := make(map[int]*packIndex, len(ids))
+	nonEmpty := make([]int, 0, len(ids))
+	start := 0
+	for _, id := range ids {
+		idx, err := b.readPack(id)
+		if err != nil {
+			return err
+		}
+		if idx.PackSize == 0 {
+			// the active pack of a run that wrote nothing
+			b.removePackFiles(id)
+			continue
+		}
+		indexes[id] = idx
+		if idx.Compacted {
+			start = len(nonEmpty)
+		}
+		nonEmpty = append(nonEmpty, id)
+	}
+	ids = nonEmpty
+	// a compacted pack supersedes every pack before it; they are only still
+	// here if a compaction was interrupted before deleting them
+	for _, id := range ids[:start] {
+		b.removePackFiles(id)
+	}
+	for _, id := range ids[start:] {
+		f, err := os.Open(b.packPath(id))
+		if err != nil {
+			return fmt.Errorf("failed to open pack %d: %w", id, err)
+		}
+		p := &pack{id: id, f: f, size: indexes[id].PackSize}
+		b.packs[id] = p
+		for _, rec := range indexes[id].Records {
+			b.apply(p, rec)
+		}
+	}
+	if start > 0 {
+		return syncDir(b.dir)
+	}
+	return nil
+}
+
+// readPack returns the records of a pack from its index file, or by scanning
+// it (and writing the index) if the index is missing or stale.
+func (b *PackBackend) readPack(id int) (*packIndex, error) {
+	info, err := os.Stat(b.packPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat pack %d: %w", id, err)
+	}
+	if data, err := os.ReadFile(b.indexPath(id)); err == nil {
+		idx := &packIndex{}
+		if json.Unmarshal(data, idx) == nil && idx.PackSize == info.Size() {
+			return idx, nil
+		}
+		slog.Warn("Index of pack is stale, rescanning", "pack", id)
+	}
+
+	idx, err := scanPack(b.packPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if idx.PackSize < info.Size() {
+		slog.Warn("Dropping bytes torn by a crash from the end of pack", "pack", id, "bytes", info.Size()-idx.PackSize)
+		if err := os.Truncate(b.packPath(id), idx.PackSize); err != nil {
+			return nil, fmt.Errorf("failed to truncate pack %d: %w", id, err)
+		}
+	}
+	if err := b.writeIndex(id, idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// scanPack reads records from the start of a pack up to the first one that
+// is incomplete or fails its CRC.
+func scanPack(path string) (*packIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pack %s: %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat pack %s: %w", path, err)
+	}
+	idx := &packIndex{Records: make([]packRecord, 0)}
+	header := make([]byte, packHeaderSize)
+	for {
+		if _, err := f.ReadAt(header, idx.PackSize); err != nil {
+			break
+		}
+		if binary.BigEndian.Uint32(header[0:4]) != packMagic {
+			break
+		}
+		keyLen := int64(binary.BigEndian.Uint16(header[9:11]))
+		dataLen := int64(binary.BigEndian.Uint32(header[11:15]))
+		if idx.PackSize+packHeaderSize+keyLen+dataLen > info.Size() {
+			// torn, or a corrupt length that must not be allocated
+			break
+		}
+		body := make([]byte, keyLen+dataLen)
+		if _, err := f.ReadAt(body, idx.PackSize+packHeaderSize); err != nil {
+			break
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header[8:])
+		crc.Write(body)
+		if crc.Sum32() != binary.BigEndian.Uint32(header[4:8]) {
+			break
+		}
+		rec := packRecord{
+			Kind:    header[8],
+			Key:     string(body[:keyLen]),
+			Offset:  idx.PackSize + packHeaderSize + keyLen,
+			Size:    dataLen,
+			ModTime: int64(binary.BigEndian.Uint64(header[15:23])),
+			Sum:     append([]byte(nil), header[23:]...),
+		}
+		if rec.Kind == recordCompacted {
+			idx.Compacted = true
+		}
+		idx.Records = append(idx.Records, rec)
+		idx.PackSize += rec.recordSize()
+	}
+	return idx, nil
+}
+
+func (b *PackBackend) writeIndex(id int, idx *packIndex) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(b.indexPath(id), data)
+}
+
+func (b *PackBackend) removePackFiles(id int) {
+	if err := os.Remove(b.packPath(id)); err != nil && !os.IsNotExist(err) {
+		slog.Error("Failed to remove pack", "pack", id, "error", err)
+	}
+	if err := os.Remove(b.indexPath(id)); err != nil && !os.IsNotExist(err) {
+		slog.Error("Failed to remove index of pack", "pack", id, "error", err)
+	}
+}
+
+// apply updates the index with a record of p, accounting for the bytes it
+// makes dead. Must be called with mu held.
+func (b *PackBackend) apply(p *pack, rec packRecord) {
+	switch rec.Kind {
+	case recordPut, recordDelete:
+		if old, ok := b.index[rec.Key]; ok {
+			if oldPack, ok := b.packs[old.pack]; ok {
+				oldPack.dead += old.rec.recordSize()
+			}
+			delete(b.index, rec.Key)
+			b.files.remove(rec.Key)
+		}
+		if rec.Kind == recordPut {
+			b.index[rec.Key] = packEntry{pack: p.id, rec: rec}
+			b.files.put(rec.Key, rec.Size)
+		} else {
+			p.dead += rec.recordSize()
+		}
+	}
+}
+
+func (b *PackBackend) createPack(id int) (*pack, error) {
+	f, err := os.OpenFile(b.packPath(id), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pack %d: %w", id, err)
+	}
+	if err := syncDir(b.dir); err != nil {
+		f.Close()
+		return nil, err
+	}
+	p := &pack{id: id, f: f, recs: make([]packRecord, 0)}
+	b.packs[id] = p
+	return p, nil
+}
+
+// encodeRecord lays out rec, whose data is data, as it is stored in a pack.
+func encodeRecord(rec packRecord, data []byte) []byte {
+	buf := make([]byte, packHeaderSize+len(rec.Key)+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], packMagic)
+	buf[8] = rec.Kind
+	binary.BigEndian.PutUint16(buf[9:11], uint16(len(rec.Key)))
+	binary.BigEndian.PutUint32(buf[11:15], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[15:23], uint64(rec.ModTime))
+	copy(buf[23:packHeaderSize], rec.Sum)
+	copy(buf[packHeaderSize:], rec.Key)
+	copy(buf[packHeaderSize+len(rec.Key):], data)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+	return buf
+}
+
+// appendRecords durably appends records to the active pack with a single
+// write and sync, data[i] being the data of recs[i], and applies them. The
+// pack is sealed once it is full. Must be called with mu held.
+func (b *PackBackend) appendRecords(recs []packRecord, data [][]byte) error {
+	p := b.active
+	now := time.Now().UnixNano()
+	var buf bytes.Buffer
+	for i := range recs {
+		if len(recs[i].Key) > 0xFFFF || int64(len(data[i])) > 0xFFFFFFFF {
+			return fmt.Errorf("file %s is too large for a pack", recs[i].Key)
+		}
+		if recs[i].Sum == nil {
+			recs[i].Sum = make([]byte, sha256.Size)
+		}
+		recs[i].ModTime = now
+		recs[i].Offset = p.size + int64(buf.Len()) + packHeaderSize + int64(len(recs[i].Key))
+		recs[i].Size = int64(len(data[i]))
+		buf.Write(encodeRecord(recs[i], data[i]))
+	}
+	if err := b.appendBytes(p, bytes.NewReader(buf.Bytes())); err != nil {
+		return err
+	}
+	return b.applyAppended(p, recs)
+}
+
+// appendBytes durably appends r to the end of p. If that fails, whatever
+// part of it was written is cut off again so it cannot be replayed later.
+// Must be called with mu held.
+func (b *PackBackend) appendBytes(p *pack, r io.Reader) error {
+	n, err := io.Copy(io.NewOffsetWriter(p.f, p.size), r)
+	if err == nil {
+		err = p.f.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			if truncErr := p.f.Truncate(p.size); truncErr != nil {
+				slog.Error("Failed to cut a failed append off pack", "pack", p.id, "error", truncErr)
+			}
+		}
+		return fmt.Errorf("failed to append to pack %d: %w", p.id, err)
+	}
+	p.size += n
+	return nil
+}
+
+// applyAppended applies records just appended to p, sealing it once it is
+// full. Must be called with mu held.
+func (b *PackBackend) applyAppended(p *pack, recs []packRecord) error {
+	for _, rec := range recs {
+		p.recs = append(p.recs, rec)
+		b.apply(p, rec)
+	}
+	if p.size >= packMaxSize {
+		return b.seal()
+	}
+	return nil
+}
+
+// seal writes the index of the active pack and starts a new one. Must be
+// called with mu held.
+func (b *PackBackend) seal() error {
+	p := b.active
+	if err := b.writeIndex(p.id, &packIndex{PackSize: p.size, Records: p.recs}); err != nil {
+		return err
+	}
+	next, err := b.createPack(p.id + 1)
+	if err != nil {
+		return err
+	}
+	p.recs = nil
+	b.active = next
+	return nil
+}
+
+func (b *PackBackend) Read(name string) ([]byte, []byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entry, ok := b.index[name]
+	if !ok {
+		slog.Debug("File not found", "file", name)
+		return nil, nil, fmt.Errorf("file not found: %s: %w", name, os.ErrNotExist)
+	}
+	data := make([]byte, entry.rec.Size)
+	if _, err := b.packs[entry.pack].f.ReadAt(data, entry.rec.Offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("failed to read %s from pack %d: %w", name, entry.pack, err)
+	}
+	return data, entry.rec.Sum, nil
+}
+
+// packFile reads one file out of its own handle on a pack, so it stays
+// readable while compaction replaces and closes the backend's handles.
+type packFile struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (pf *packFile) Close() error {
+	return pf.f.Close()
+}
+
+func (b *PackBackend) Open(name string) (io.ReadSeekCloser, FileStat, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entry, ok := b.index[name]
+	if !ok {
+		return nil, FileStat{}, fmt.Errorf("file not found: %s: %w", name, os.ErrNotExist)
+	}
+	// compaction renames over pack paths only while holding mu, so the path
+	// still names the pack the entry points into
+	f, err := os.Open(b.packPath(entry.pack))
+	if err != nil {
+		return nil, FileStat{}, fmt.Errorf("failed to open pack %d: %w", entry.pack, err)
+	}
+	stat := FileStat{Size: entry.rec.Size, ModTime: time.Unix(0, entry.rec.ModTime), Sum: entry.rec.Sum}
+	return &packFile{SectionReader: io.NewSectionReader(f, entry.rec.Offset, entry.rec.Size), f: f}, stat, nil
+}
+
+func (b *PackBackend) Write(name string, data []byte, sum []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.appendRecords([]packRecord{{Kind: recordPut, Key: name, Sum: sum}}, [][]byte{data})
+}
+
+func (b *PackBackend) Remove(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.index[name]; !ok {
+		return fmt.Errorf("file not found: %s: %w", name, os.ErrNotExist)
+	}
+	return b.appendRecords([]packRecord{{Kind: recordDelete, Key: name}}, [][]byte{nil})
+}
+
+// packBatch stages the encoded records of a batch in a temp file, so a large
+// batch is not held in memory, and appends them to the active pack with a
+// single sync on Commit.
+type packBatch struct {
+	b    *PackBackend
+	tmp  *os.File
+	size int64
+	recs []packRecord // offsets relative to the start of tmp
+}
+
+func (b *PackBackend) BeginBatch() (Batch, error) {
+	tmp, err := os.CreateTemp(b.dir, ".batch"+tempMarker+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch file: %w", err)
+	}
+	return &packBatch{b: b, tmp: tmp}, nil
+}
+
+func (batch *packBatch) Add(name string, data []byte, sum []byte) error {
+	if len(name) > 0xFFFF || int64(len(data)) > 0xFFFFFFFF {
+		batch.Abort()
+		return fmt.Errorf("file %s is too large for a pack", name)
+	}
+	rec := packRecord{Kind: recordPut, Key: name, ModTime: time.Now().UnixNano(), Sum: sum}
+	buf := encodeRecord(rec, data)
+	if _, err := batch.tmp.Write(buf); err != nil {
+		batch.Abort()
+		return fmt.Errorf("failed to stage %s: %w", name, err)
+	}
+	rec.Offset = batch.size + packHeaderSize + int64(len(name))
+	rec.Size = int64(len(data))
+	batch.recs = append(batch.recs, rec)
+	batch.size += int64(len(buf))
+	return nil
+}
+
+func (batch *packBatch) Commit() error {
+	defer batch.Abort()
+	if len(batch.recs) == 0 {
+		return nil
+	}
+	b := batch.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.active
+	base := p.size
+	if err := b.appendBytes(p, io.NewSectionReader(batch.tmp, 0, batch.size)); err != nil {
+		return err
+	}
+	for i := range batch.recs {
+		batch.recs[i].Offset += base
+	}
+	return b.applyAppended(p, batch.recs)
+}
+
+func (batch *packBatch) Abort() {
+	if batch.tmp == nil {
+		return
+	}
+	batch.tmp.Close()
+	os.Remove(batch.tmp.Name())
+	batch.tmp = nil
+}
+
+func (b *PackBackend) Stat(name string) (FileStat, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entry, ok := b.index[name]
+	if !ok {
+		return FileStat{}, fmt.Errorf("file not found: %s: %w", name, os.ErrNotExist)
+	}
+	return FileStat{Size: entry.rec.Size, ModTime: time.Unix(0, entry.rec.ModTime), Sum: entry.rec.Sum}, nil
+}
+
+// DeleteVideo appends a tombstone for every file of the video at once.
+func (b *PackBackend) DeleteVideo(videoId string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := b.files.videoFiles(videoId)
+	if len(names) == 0 {
+		return 0, nil
+	}
+	recs := make([]packRecord, 0, len(names))
+	for _, name := range names {
+		recs = append(recs, packRecord{Kind: recordDelete, Key: name})
+	}
+	return len(names), b.appendRecords(recs, make([][]byte, len(names)))
+}
+
+func (b *PackBackend) List(opts ListOptions) ([]*pb.FileInfo, string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	infos, next := b.files.list(opts)
+	return infos, next, nil
+}
+
+func (b *PackBackend) Verify(name string) (bool, error) {
+	data, sum, err := b.Read(name)
+	if err != nil {
+		return false, err
+	}
+	got := sha256.Sum256(data)
+	return bytes.Equal(got[:], sum), nil
+}
+
+// StartCompaction checks every interval whether enough of the sealed packs
+// is dead to be worth compacting.
+func (b *PackBackend) StartCompaction(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+			}
+			if err := b.maybeCompact(); err != nil {
+				slog.Error("Compaction failed", "error", err)
+			}
+		}
+	}()
+}
+
+func (b *PackBackend) maybeCompact() error {
+	b.mu.RLock()
+	var size, dead int64
+	for id, p := range b.packs {
+		if id != b.active.id {
+			size += p.size
+			dead += p.dead
+		}
+	}
+	b.mu.RUnlock()
+	if size == 0 || float64(dead)/float64(size) < compactThreshold {
+		return nil
+	}
+	return b.Compact()
+}
+
+// Compact rewrites the live files of every sealed pack into a single pack
+// that takes the id of the newest one, then deletes the others. Writes carry
+// on to the active pack meanwhile; files they replace or delete are dropped
+// from the compacted pack's entries when it is swapped in, and the records in
+// the active pack win on replay. The compacted pack is renamed into place
+// before the packs it replaces are deleted, so a crash in between leaves
+// packs that its compacted record tells the next open to discard.
+func (b *PackBackend) Compact() error {
+	b.compactMu.Lock()
+	defer b.compactMu.Unlock()
+
+	b.mu.RLock()
+	sealed := make([]int, 0)
+	files := make(map[int]*os.File)
+	for id, p := range b.packs {
+		if id != b.active.id {
+			sealed = append(sealed, id)
+			files[id] = p.f
+		}
+	}
+	live := make([]packEntry, 0)
+	for _, entry := range b.index {
+		if entry.pack != b.active.id {
+			live = append(live, entry)
+		}
+	}
+	b.mu.RUnlock()
+	if len(sealed) == 0 {
+		return nil
+	}
+	sort.Ints(sealed)
+	target := sealed[len(sealed)-1]
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].pack != live[j].pack {
+			return live[i].pack < live[j].pack
+		}
+		return live[i].rec.Offset < live[j].rec.Offset
+	})
+	start := time.Now()
+
+	// sealed packs are immutable and only closed by this function, so they
+	// can be read without holding mu
+	tmp, err := os.CreateTemp(b.dir, ".pack-compact"+tempMarker+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create compacted pack: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	idx := &packIndex{Compacted: true, Records: make([]packRecord, 0, len(live)+1)}
+	write := func(rec packRecord, data []byte) error {
+		buf := encodeRecord(rec, data)
+		if _, err := tmp.Write(buf); err != nil {
+			return err
+		}
+		rec.Offset = idx.PackSize + packHeaderSize + int64(len(rec.Key))
+		rec.Size = int64(len(data))
+		idx.Records = append(idx.Records, rec)
+		idx.PackSize += int64(len(buf))
+		return nil
+	}
+	err = write(packRecord{Kind: recordCompacted, ModTime: time.Now().UnixNano(), Sum: make([]byte, sha256.Size)}, nil)
+	for _, entry := range live {
+		if err != nil {
+			break
+		}
+		data := make([]byte, entry.rec.Size)
+		if _, err = files[entry.pack].ReadAt(data, entry.rec.Offset); err != nil && !errors.Is(err, io.EOF) {
+			break
+		}
+		err = write(entry.rec, data)
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write compacted pack: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// until the new index is written, the next open must scan the new pack
+	if err := os.Remove(b.indexPath(target)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove index of pack %d: %w", target, err)
+	}
+	if err := os.Rename(tmp.Name(), b.packPath(target)); err != nil {
+		return fmt.Errorf("failed to rename compacted pack: %w", err)
+	}
+	if err := syncDir(b.dir); err != nil {
+		return err
+	}
+	f, err := os.Open(b.packPath(target))
+	if err != nil {
+		return fmt.Errorf("failed to open compacted pack: %w", err)
+	}
+	for _, id := range sealed {
+		b.packs[id].f.Close()
+		delete(b.packs, id)
+	}
+	compacted := &pack{id: target, f: f, size: idx.PackSize}
+	b.packs[target] = compacted
+	for i, entry := range live {
+		rec := idx.Records[i+1]
+		if current, ok := b.index[entry.rec.Key]; ok && current.pack == entry.pack && current.rec.Offset == entry.rec.Offset {
+			b.index[entry.rec.Key] = packEntry{pack: target, rec: rec}
+		} else {
+			// replaced or deleted in the active pack while compacting
+			compacted.dead += rec.recordSize()
+		}
+	}
+	if err := b.writeIndex(target, idx); err != nil {
+		return err
+	}
+	for _, id := range sealed[:len(sealed)-1] {
+		b.removePackFiles(id)
+	}
+	if err := syncDir(b.dir); err != nil {
+		return err
+	}
+	slog.Info("Compacted packs", "packs", len(sealed), "into", target, "files", len(live), "bytes", idx.PackSize, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (b *PackBackend) Close() error {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	b.compactMu.Lock()
+	defer b.compactMu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, p := range b.packs {
+		p.f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openPack(t *testing.T, dir string) *PackBackend {
+	b, err := OpenPackBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// sealActive seals the active pack, as if it had filled up.
+func sealActive(t *testing.T, b *PackBackend) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.active.id
+	if err := b.seal(); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func readString(t *testing.T, b Backend, name string) string {
+	data, _, err := b.Read(name)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func overwrite(t *testing.T, path string, offset int64, data []byte) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, offset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A record torn or corrupted by a crash is dropped on the next open, along
+// with the bytes after it, and the records before it are kept.
+func TestPackBackendDropsBadTail(t *testing.T) {
+	tails := map[string]func(t *testing.T, path string, start, end int64){
+		"torn": func(t *testing.T, path string, start, end int64) {
+			if err := os.Truncate(path, end-3); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"crc mismatch": func(t *testing.T, path string, start, end int64) {
+			overwrite(t, path, end-1, []byte("X"))
+		},
+		"huge length": func(t *testing.T, path string, start, end int64) {
+			// a data length far past the end of the pack
+			overwrite(t, path, start+11, []byte{0xFF, 0xFF, 0xFF, 0xFF})
+		},
+	}
+	for name, corrupt := range tails {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			b, err := OpenPackBackend(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, b, "vid/manifest.mpd", "manifest")
+			good := b.active.size
+			writeFile(t, b, "vid/chunk.m4s", "segment")
+			path, size := b.packPath(b.active.id), b.active.size
+			if err := b.Close(); err != nil {
+				t.Fatal(err)
+			}
+			corrupt(t, path, good, size)
+
+			b = openPack(t, dir)
+			if got := readString(t, b, "vid/manifest.mpd"); got != "manifest" {
+				t.Errorf("manifest reads %q", got)
+			}
+			if _, err := b.Stat("vid/chunk.m4s"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("bad record still read: %v", err)
+			}
+			if info, err := os.Stat(path); err != nil || info.Size() != good {
+				t.Errorf("pack not truncated to %d bytes: %v, %v", good, info.Size(), err)
+			}
+
+			// the pack is usable again
+			writeFile(t, b, "vid/chunk.m4s", "segment")
+			b.Close()
+			b = openPack(t, dir)
+			if got := readString(t, b, "vid/chunk.m4s"); got != "segment" {
+				t.Errorf("rewritten chunk reads %q", got)
+			}
+		})
+	}
+}
+
+// A sealed pack whose index is missing or does not match it is scanned
+// instead, and its index written again.
+func TestPackBackendRebuildsIndex(t *testing.T) {
+	indexes := map[string]func(t *testing.T, path string){
+		"missing": func(t *testing.T, path string) {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"unreadable": func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte(`{"pack_size": 12`), 0644); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"stale": func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte(`{"pack_size": 1, "records": []}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	for name, damage := range indexes {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			b, err := OpenPackBackend(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, b, "vid/manifest.mpd", "manifest")
+			writeFile(t, b, "vid/chunk.m4s", "segment")
+			writeFile(t, b, "gone/chunk.m4s", "segment")
+			if err := b.Remove("gone/chunk.m4s"); err != nil {
+				t.Fatal(err)
+			}
+			id := sealActive(t, b)
+			want := listSizes(t, b)
+			if err := b.Close(); err != nil {
+				t.Fatal(err)
+			}
+			damage(t, b.indexPath(id))
+
+			b = openPack(t, dir)
+			if got := listSizes(t, b); !sameSizes(got, want) {
+				t.Errorf("files after reopen = %v, want %v", got, want)
+			}
+			if got := readString(t, b, "vid/chunk.m4s"); got != "segment" {
+				t.Errorf("chunk reads %q", got)
+			}
+			idx, err := b.readPack(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info, err := os.Stat(b.packPath(id)); err != nil || idx.PackSize != info.Size() || len(idx.Records) != 4 {
+				t.Errorf("index not rewritten: %+v", idx)
+			}
+		})
+	}
+}
+
+// Compaction copies the live files of the sealed packs into one pack and
+// drops everything else, and the result survives a reopen.
+func TestPackBackendCompaction(t *testing.T) {
+	dir := t.TempDir()
+	b := openPack(t, dir)
+	writeFile(t, b, "vid/manifest.mpd", "manifest")
+	writeFile(t, b, "vid/chunk.m4s", "old segment")
+	writeFile(t, b, "gone/chunk.m4s", "segment")
+	sealActive(t, b)
+	writeFile(t, b, "vid/chunk.m4s", "segment")
+	if err := b.Remove("gone/chunk.m4s"); err != nil {
+		t.Fatal(err)
+	}
+	target := sealActive(t, b)
+	// the active pack is left alone
+	writeFile(t, b, "new/chunk.m4s", "new segment")
+	want := map[string]int64{"vid/manifest.mpd": 8, "vid/chunk.m4s": 7, "new/chunk.m4s": 11}
+
+	if err := b.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	check := func(b *PackBackend) {
+		t.Helper()
+		if got := listSizes(t, b); !sameSizes(got, want) {
+			t.Errorf("files = %v, want %v", got, want)
+		}
+		if got := readString(t, b, "vid/chunk.m4s"); got != "segment" {
+			t.Errorf("chunk reads %q", got)
+		}
+		if got := readString(t, b, "new/chunk.m4s"); got != "new segment" {
+			t.Errorf("new chunk reads %q", got)
+		}
+	}
+	check(b)
+
+	packs, err := filepath.Glob(filepath.Join(dir, "pack-*.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) != 2 {
+		t.Errorf("packs after compaction = %v, want the compacted and the active one", packs)
+	}
+	idx, err := scanPack(b.packPath(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0)
+	for _, rec := range idx.Records[1:] {
+		if rec.Kind != recordPut {
+			t.Errorf("compacted pack holds a record of kind %d", rec.Kind)
+		}
+		keys = append(keys, rec.Key)
+	}
+	if !idx.Compacted || len(keys) != 2 {
+		t.Errorf("compacted pack holds %v, want only the two live files", keys)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check(openPack(t, dir))
+}
@@ -0,0 +1,71 @@
+// Registration with the coordinator and heartbeats
+
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	pb "tritontube/internal/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// how long to wait before retrying a failed registration
+const registerRetryInterval = 2 * time.Second
+
+// RunHeartbeats registers the node at advertiseAddr with the coordinator and
+// keeps sending heartbeats until ctx is cancelled. If the coordinator does
+// not know the node, for example after it restarted, the node registers again.
+func RunHeartbeats(ctx context.Context, coordinatorAddr string, advertiseAddr string, capacity int64) error {
+	conn, err := grpc.NewClient(coordinatorAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := pb.NewVideoContentAdminServiceClient(conn)
+
+	for ctx.Err() == nil {
+		interval := register(ctx, client, advertiseAddr, capacity)
+		for ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+			resp, err := client.Heartbeat(ctx, &pb.HeartbeatRequest{NodeAddress: advertiseAddr})
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("Heartbeat to coordinator failed", "coordinator", coordinatorAddr, "error", err)
+				}
+				continue
+			}
+			if !resp.Registered {
+				slog.Warn("Coordinator does not know this node, registering again", "coordinator", coordinatorAddr)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// register retries until the coordinator accepts the node and returns the
+// heartbeat interval it asked for.
+func register(ctx context.Context, client pb.VideoContentAdminServiceClient, advertiseAddr string, capacity int64) time.Duration {
+	for {
+		resp, err := client.Register(ctx, &pb.RegisterRequest{NodeAddress: advertiseAddr, CapacityBytes: capacity})
+		if err == nil {
+			slog.Info("Registered with coordinator", "advertise", advertiseAddr)
+			return time.Duration(resp.HeartbeatIntervalMs) * time.Millisecond
+		}
+		if ctx.Err() != nil {
+			return 0
+		}
+		slog.Warn("Failed to register with coordinator", "error", err)
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(registerRetryInterval):
+		}
+	}
+}
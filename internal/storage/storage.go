@@ -3,13 +3,23 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"path"
-	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 	pb "tritontube/internal/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // this is basically only the GRPC server which stores at <dir>/<port> -- the folder is created when a new server is created
@@ -17,95 +27,340 @@ import (
 type StorageService struct {
 	pb.UnimplementedStorageServiceServer
 	baseDir string
+	backend Backend
+	started time.Time
+
+	scrubMu   sync.Mutex
+	corrupt   []string // files that failed the last scrub
+	lastScrub time.Time
 }
 
-func NewStorageService(baseDir string) (*StorageService, error) {
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create base directory %s: %w", baseDir, err)
-	}
-	return &StorageService{baseDir: baseDir}, nil
+// NewStorageService serves the files kept by backend. baseDir is the
+// directory backend stores them in.
+func NewStorageService(baseDir string, backend Backend) *StorageService {
+	return &StorageService{baseDir: baseDir, backend: backend, started: time.Now()}
 }
 
 func (ss *StorageService) Read(ctx context.Context, rr *pb.ReadRequest) (*pb.ReadResponse, error) {
-	// fmt.Printf("base directory %s\n", ss.baseDir)
-	filePath := filepath.Join(ss.baseDir, rr.VideoId, rr.FileName)
-	fmt.Printf("Read request received for %s\n", filePath)
-	data, err := os.ReadFile(filePath)
+	name := path.Join(rr.VideoId, rr.FileName)
+	slog.DebugContext(ctx, "Read request", "file", name)
+	data, sum, err := ss.backend.Read(name)
 	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Printf("file not found %s\n", filePath)
-			return nil, fmt.Errorf("file not found: %w", err)
-		}
-		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+		return nil, statusError(err)
+	}
+	if len(sum) == 0 {
+		// stored before checksums were kept; web servers still need one for the ETag
+		hash := sha256.Sum256(data)
+		sum = hash[:]
 	}
+	// the reader verifies the data against the checksum stored at write time
 	return &pb.ReadResponse{
 		FileData: data,
+		Sha256:   sum,
 	}, nil
 }
 
 func (ss *StorageService) Remove(ctx context.Context, rr *pb.RemoveRequest) (*pb.RemoveResponse, error) {
-	filePath := filepath.Join(ss.baseDir, rr.VideoId, rr.FileName)
-	fmt.Printf("Remove request received for %s\n", filePath)
-	err := os.Remove(filePath)
+	name := path.Join(rr.VideoId, rr.FileName)
+	slog.DebugContext(ctx, "Remove request", "file", name)
+	err := ss.backend.Remove(name)
 	if err != nil {
-		fmt.Printf("Failed to remove file: %v\n", err)
-		return nil, err
+		slog.WarnContext(ctx, "Failed to remove file", "file", name, "error", err)
+		return nil, statusError(err)
 	} else {
-		fmt.Println("File removed successfully.")
+		slog.InfoContext(ctx, "Removed file", "file", name)
 		return &pb.RemoveResponse{}, nil
 	}
 }
 
 func (ss *StorageService) Write(ctx context.Context, wr *pb.WriteRequest) (*pb.WriteResponse, error) {
-	videoDir := filepath.Join(ss.baseDir, wr.VideoId)
-
-	if err := os.MkdirAll(videoDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create video directory %s: %w", videoDir, err)
+	name := path.Join(wr.VideoId, wr.FileName)
+	slog.DebugContext(ctx, "Write request", "file", name)
+	sum := sha256.Sum256(wr.FileData)
+	if len(wr.Sha256) > 0 && !bytes.Equal(wr.Sha256, sum[:]) {
+		return nil, status.Errorf(codes.DataLoss, "checksum mismatch writing %s: expected %x, data hashes to %x", name, wr.Sha256, sum)
+	}
+	if err := ss.backend.Write(name, wr.FileData, sum[:]); err != nil {
+		return nil, err
 	}
 
-	filePath := filepath.Join(videoDir, wr.FileName)
-	fmt.Printf("Write request received for %s\n", filePath)
-	err := os.WriteFile(filePath, wr.FileData, 0644)
+	return &pb.WriteResponse{}, nil
+
+}
+
+// Stat describes a file without sending it, optionally re-hashing it first.
+func (ss *StorageService) Stat(ctx context.Context, sr *pb.StatRequest) (*pb.StatResponse, error) {
+	name := path.Join(sr.VideoId, sr.FileName)
+	if sr.Verify {
+		ok, err := ss.backend.Verify(name)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		if !ok {
+			return nil, status.Errorf(codes.DataLoss, "%s does not match its checksum", name)
+		}
+	}
+	stat, err := ss.backend.Stat(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write file %s: %w", filePath, err)
+		return nil, statusError(err)
 	}
+	if len(stat.Sum) == 0 {
+		// stored before checksums were kept; web servers still need one for the ETag
+		f, openStat, err := ss.backend.Open(name)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		stat = openStat
+		stat.Sum, err = hashFile(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", name, err)
+		}
+	}
+	return &pb.StatResponse{
+		Size:        stat.Size,
+		MtimeUnixMs: stat.ModTime.UnixMilli(),
+		Sha256:      stat.Sum,
+	}, nil
+}
 
-	return &pb.WriteResponse{}, nil
+func (ss *StorageService) Exists(ctx context.Context, er *pb.ExistsRequest) (*pb.ExistsResponse, error) {
+	_, err := ss.backend.Stat(path.Join(er.VideoId, er.FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &pb.ExistsResponse{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ExistsResponse{Exists: true}, nil
+}
 
+func (ss *StorageService) DeleteVideo(ctx context.Context, dr *pb.DeleteVideoRequest) (*pb.DeleteVideoResponse, error) {
+	slog.DebugContext(ctx, "Delete request", "video", dr.VideoId)
+	if dr.VideoId == "" || strings.ContainsAny(dr.VideoId, "/\\") || dr.VideoId == "." || dr.VideoId == ".." {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid video id %q", dr.VideoId)
+	}
+	deleted, err := ss.backend.DeleteVideo(dr.VideoId)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to delete video", "video", dr.VideoId, "error", err)
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Deleted video", "video", dr.VideoId, "files", deleted)
+	return &pb.DeleteVideoResponse{FilesDeleted: int32(deleted)}, nil
 }
 
-func (ss *StorageService) List(ctx context.Context, lr *pb.ListRequest) (*pb.ListResponse, error) {
-	responseList := make([]string, 0)
+// statusError reports a missing file to the client as NOT_FOUND.
+func statusError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return err
+}
 
-	entries, err := os.ReadDir(ss.baseDir)
+// WriteBatch stages every file on the stream and commits them together
+// once the client closes it. A rejected file or a broken stream discards
+// the whole batch.
+func (ss *StorageService) WriteBatch(stream pb.StorageService_WriteBatchServer) error {
+	batch, err := ss.backend.BeginBatch()
 	if err != nil {
-		// log.Fatal(err)
+		return err
+	}
+	count := 0
+	for {
+		wr, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			batch.Abort()
+			slog.WarnContext(stream.Context(), "Write batch aborted", "files", count, "error", err)
+			return err
+		}
+		name := path.Join(wr.VideoId, wr.FileName)
+		sum := sha256.Sum256(wr.FileData)
+		if len(wr.Sha256) > 0 && !bytes.Equal(wr.Sha256, sum[:]) {
+			batch.Abort()
+			return status.Errorf(codes.DataLoss, "checksum mismatch writing %s: expected %x, data hashes to %x", name, wr.Sha256, sum)
+		}
+		if err := batch.Add(name, wr.FileData, sum[:]); err != nil {
+			batch.Abort()
+			return err
+		}
+		count++
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	slog.InfoContext(stream.Context(), "Write batch committed", "files", count)
+	return stream.SendAndClose(&pb.WriteBatchResponse{FilesWritten: int32(count)})
+}
+
+// hashFile returns the SHA-256 of what is left to read in f.
+func hashFile(f io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
 		return nil, err
 	}
+	return hash.Sum(nil), nil
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			subdir := entry.Name()
-			subdirPath := filepath.Join(ss.baseDir, subdir)
+// readStreamChunkSize is the most file data sent in one ReadStream message.
+const readStreamChunkSize = 256 << 10
 
-			subEntries, err := os.ReadDir(subdirPath)
-			if err != nil {
-				log.Printf("Skipping %s: %v", subdirPath, err)
-				continue
+// ReadStream sends a file from the requested offset in chunks, so it is never
+// held in memory whole.
+func (ss *StorageService) ReadStream(rr *pb.ReadStreamRequest, stream pb.StorageService_ReadStreamServer) error {
+	name := path.Join(rr.VideoId, rr.FileName)
+	slog.DebugContext(stream.Context(), "Read stream request", "file", name, "offset", rr.Offset)
+	f, stat, err := ss.backend.Open(name)
+	if err != nil {
+		return statusError(err)
+	}
+	defer f.Close()
+	if rr.Offset < 0 || rr.Offset > stat.Size {
+		return status.Errorf(codes.OutOfRange, "offset %d is outside %s of %d bytes", rr.Offset, name, stat.Size)
+	}
+	if len(stat.Sum) == 0 {
+		// stored before checksums were kept; web servers still need one for the ETag
+		if stat.Sum, err = hashFile(f); err != nil {
+			return fmt.Errorf("failed to hash %s: %w", name, err)
+		}
+	}
+	if _, err := f.Seek(rr.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek in %s: %w", name, err)
+	}
+	response := &pb.ReadStreamResponse{
+		Size:        stat.Size,
+		MtimeUnixMs: stat.ModTime.UnixMilli(),
+		Sha256:      stat.Sum,
+	}
+	for first := true; ; first = false {
+		buf := make([]byte, readStreamChunkSize)
+		n, err := io.ReadFull(f, buf)
+		done := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !done {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		// the first message goes out even for an empty file
+		if n > 0 || first {
+			response.Data = buf[:n]
+			if err := stream.Send(response); err != nil {
+				return err
 			}
+			response = &pb.ReadStreamResponse{}
+		}
+		if done {
+			return nil
+		}
+	}
+}
 
-			for _, subEntry := range subEntries {
-				if !subEntry.IsDir() {
-					responseList = append(responseList, path.Join(subdir, subEntry.Name()))
-				}
-			}
+// WriteStream collects the chunks of one file and writes it once the client
+// closes the stream. Backends write whole files, so the node holds all of
+// it, but the client only ever holds a chunk.
+func (ss *StorageService) WriteStream(stream pb.StorageService_WriteStreamServer) error {
+	var name string
+	var expected []byte
+	var data bytes.Buffer
+	for {
+		wr, err := stream.Recv()
+		if err == io.EOF {
+			break
 		}
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = path.Join(wr.VideoId, wr.FileName)
+		}
+		data.Write(wr.Data)
+		if len(wr.Sha256) > 0 {
+			expected = wr.Sha256
+		}
+	}
+	if name == "" {
+		return status.Error(codes.InvalidArgument, "write stream names no file")
+	}
+	slog.DebugContext(stream.Context(), "Write stream", "file", name)
+	sum := sha256.Sum256(data.Bytes())
+	if len(expected) > 0 && !bytes.Equal(expected, sum[:]) {
+		return status.Errorf(codes.DataLoss, "checksum mismatch writing %s: expected %x, data hashes to %x", name, expected, sum)
+	}
+	if err := ss.backend.Write(name, data.Bytes(), sum[:]); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&pb.WriteResponse{})
+}
+
+// maxListPageSize caps a List page to keep responses well under the gRPC
+// message size limit.
+const maxListPageSize = 10000
+
+// List serves a page of the node's files from the backend's index, filtered
+// by video prefix and hash range.
+func (ss *StorageService) List(ctx context.Context, lr *pb.ListRequest) (*pb.ListResponse, error) {
+	pageSize := int(lr.PageSize)
+	if pageSize <= 0 || pageSize > maxListPageSize {
+		pageSize = maxListPageSize
+	}
+	infos, next, err := ss.backend.List(ListOptions{
+		Prefix:    lr.VideoPrefix,
+		HashRange: lr.HashRange,
+		HashStart: lr.HashStart,
+		HashEnd:   lr.HashEnd,
+		PageSize:  pageSize,
+		PageToken: lr.PageToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	responseList := make([]string, 0, len(infos))
+	for _, info := range infos {
+		responseList = append(responseList, info.Name)
 	}
 
 	return &pb.ListResponse{
-		Files: responseList,
+		Files:         responseList,
+		Infos:         infos,
+		NextPageToken: next,
 	}, nil
 
 }
 
+// Stats summarises what the node stores, per video and in total.
+func (ss *StorageService) Stats(ctx context.Context, sr *pb.StatsRequest) (*pb.StatsResponse, error) {
+	infos, _, err := ss.backend.List(ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	response := &pb.StatsResponse{
+		Videos:   make([]*pb.VideoStats, 0),
+		UptimeMs: time.Since(ss.started).Milliseconds(),
+	}
+	videos := make(map[string]*pb.VideoStats)
+	for _, info := range infos {
+		videoId := path.Dir(info.Name)
+		video, ok := videos[videoId]
+		if !ok {
+			video = &pb.VideoStats{VideoId: videoId}
+			videos[videoId] = video
+			response.Videos = append(response.Videos, video)
+		}
+		video.FileCount++
+		video.Bytes += info.Size
+		response.FileCount++
+		response.TotalBytes += info.Size
+	}
+	sort.Slice(response.Videos, func(i, j int) bool {
+		return response.Videos[i].VideoId < response.Videos[j].VideoId
+	})
+	free, err := freeDiskSpace(ss.baseDir)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get free space", "dir", ss.baseDir, "error", err)
+	}
+	response.FreeBytes = free
+	response.CorruptFiles, response.LastScrubUnixMs = ss.scrubReport()
+	return response, nil
+}
+
 // go run ./cmd/storage -host localhost -port 8090 "./storage/8090"
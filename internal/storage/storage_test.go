@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "tritontube/internal/proto"
+)
+
+// A file stored before checksums were kept is hashed when it is asked for,
+// so every response carries a checksum.
+func TestServiceHashesFileWithoutChecksum(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFSBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	writeFile(t, b, "vid/manifest.mpd", "manifest")
+	if err := os.Remove(filepath.Join(dir, "vid", "manifest.mpd"+checksumSuffix)); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte("manifest"))
+	ss := NewStorageService(dir, b)
+
+	stat, err := ss.Stat(context.Background(), &pb.StatRequest{VideoId: "vid", FileName: "manifest.mpd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stat.Sha256, want[:]) || stat.Size != 8 {
+		t.Errorf("Stat = %x, %d bytes", stat.Sha256, stat.Size)
+	}
+	read, err := ss.Read(context.Background(), &pb.ReadRequest{VideoId: "vid", FileName: "manifest.mpd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read.Sha256, want[:]) {
+		t.Errorf("Read checksum = %x", read.Sha256)
+	}
+}
@@ -0,0 +1,582 @@
+// LRU cache of video files in front of a content service
+
+package web
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheOptions configures a CachedVideoContentService.
+type CacheOptions struct {
+	MaxBytes     int64         // memory budget of the cache
+	Dir          string        // directory of the on-disk tier, "" for none
+	DiskMaxBytes int64         // disk budget of the on-disk tier
+	ManifestTTL  time.Duration // how long a cached .mpd is served
+	SegmentTTL   time.Duration // how long any other cached file is served
+
+	PrefetchSegments int // segments to fetch ahead of the one a viewer asks for, 0 to disable
+	PrefetchWorkers  int // most prefetches running at once
+}
+
+var DefaultCacheOptions = CacheOptions{
+	MaxBytes:     256 << 20,
+	DiskMaxBytes: 1 << 30,
+	ManifestTTL:  5 * time.Second,
+	SegmentTTL:   10 * time.Minute,
+
+	PrefetchSegments: 3,
+	PrefetchWorkers:  4,
+}
+
+// files larger than this fraction of a tier's budget are not kept in it
+const cacheMaxEntryFraction = 8
+
+// errTooLargeToCache makes callers of a shared fetch go to the content
+// service themselves.
+var errTooLargeToCache = errors.New("file too large to cache")
+
+// tooLargeError carries the file a fetch opened before finding it too large
+// to cache, so the first caller to claim it serves it without opening it
+// again.
+type tooLargeError struct {
+	mu   sync.Mutex
+	file io.ReadSeekCloser // nil once claimed
+	info *FileInfo
+}
+
+func (e *tooLargeError) Error() string { return errTooLargeToCache.Error() }
+func (e *tooLargeError) Unwrap() error { return errTooLargeToCache }
+
+// claim hands the open file to its first caller; later ones get nil.
+func (e *tooLargeError) claim() (io.ReadSeekCloser, *FileInfo) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	file := e.file
+	e.file = nil
+	return file, e.info
+}
+
+// closeUnclaimed closes the file a too large fetch opened, unless a caller
+// has taken it.
+func closeUnclaimed(err error) {
+	var tooLarge *tooLargeError
+	if errors.As(err, &tooLarge) {
+		if file, _ := tooLarge.claim(); file != nil {
+			file.Close()
+		}
+	}
+}
+
+// CacheStats counts how requests were served since the cache was created.
+type CacheStats struct {
+	MemoryHits uint64 `json:"memory_hits"`
+	DiskHits   uint64 `json:"disk_hits"`
+	Misses     uint64 `json:"misses"`
+	Coalesced  uint64 `json:"coalesced"` // misses that waited on another request's fetch
+	Evictions  uint64 `json:"evictions"`
+
+	Prefetched      uint64 `json:"prefetched"`
+	PrefetchHits    uint64 `json:"prefetch_hits"`    // hits on segments that were prefetched
+	PrefetchDropped uint64 `json:"prefetch_dropped"` // prefetches skipped because every worker was busy
+
+	MemoryBytes   int64 `json:"memory_bytes"`
+	MemoryEntries int   `json:"memory_entries"`
+	DiskBytes     int64 `json:"disk_bytes"`
+	DiskEntries   int   `json:"disk_entries"`
+}
+
+// HitRate is the fraction of lookups served from either tier.
+func (s CacheStats) HitRate() float64 {
+	total := s.MemoryHits + s.DiskHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.MemoryHits+s.DiskHits) / float64(total)
+}
+
+// CachedVideoContentService serves reads from a size-bounded LRU cache in
+// memory, and optionally on disk, in front of another content service.
+// Concurrent misses for the same file share a single fetch. Writes through
+// this service invalidate the files they touch; files changed through other
+// web servers are served stale for at most their TTL.
+type CachedVideoContentService struct {
+	VideoContentService
+	opts  CacheOptions
+	group singleflight.Group
+
+	mu     sync.Mutex
+	memory *lru
+	disk   *lru   // nil without an on-disk tier
+	gen    uint64 // bumped by every invalidation, so a fetch that raced one is not stored
+	stats  CacheStats
+
+	prefetchQueue chan prefetchJob // nil with prefetching disabled
+	manifests     map[string]*segmentIndex
+}
+
+type cacheEntry struct {
+	key     string
+	size    int64
+	info    FileInfo
+	expires time.Time
+	data    []byte // memory tier only
+	elem    *list.Element
+
+	prefetched bool // fetched ahead of a request and not yet served
+}
+
+// lru holds entries in least recently used order within a byte budget.
+type lru struct {
+	max     int64
+	bytes   int64
+	entries map[string]*cacheEntry
+	order   *list.List // front is most recently used
+	evicted func(e *cacheEntry)
+}
+
+func newLRU(max int64, evicted func(e *cacheEntry)) *lru {
+	return &lru{max: max, entries: make(map[string]*cacheEntry), order: list.New(), evicted: evicted}
+}
+
+// get returns the entry for key unless it has expired, marking it used.
+func (c *lru) get(key string, now time.Time) *cacheEntry {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(e.expires) {
+		c.remove(key)
+		return nil
+	}
+	c.order.MoveToFront(e.elem)
+	return e
+}
+
+// put adds e, evicting the least recently used entries to make room, and
+// returns how many were evicted.
+func (c *lru) put(e *cacheEntry) int {
+	c.remove(e.key)
+	evictions := 0
+	for c.bytes+e.size > c.max && c.order.Len() > 0 {
+		c.remove(c.order.Back().Value.(*cacheEntry).key)
+		evictions++
+	}
+	e.elem = c.order.PushFront(e)
+	c.entries[e.key] = e
+	c.bytes += e.size
+	return evictions
+}
+
+func (c *lru) remove(key string) {
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.order.Remove(e.elem)
+	delete(c.entries, key)
+	c.bytes -= e.size
+	if c.evicted != nil {
+		c.evicted(e)
+	}
+}
+
+// NewCachedVideoContentService caches the files read from content. If
+// opts.Dir is set, files are also kept there; cache files left in it by an
+// earlier run are removed, since the on-disk index lives in memory.
+func NewCachedVideoContentService(content VideoContentService, opts CacheOptions) (*CachedVideoContentService, error) {
+	if opts.MaxBytes <= 0 {
+		return nil, errors.New("cache size must be positive")
+	}
+	c := &CachedVideoContentService{
+		VideoContentService: content,
+		opts:                opts,
+		memory:              newLRU(opts.MaxBytes, nil),
+	}
+	if opts.Dir != "" {
+		if opts.DiskMaxBytes <= 0 {
+			return nil, errors.New("disk cache size must be positive")
+		}
+		if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory %s: %w", opts.Dir, err)
+		}
+		if err := clearCacheDir(opts.Dir); err != nil {
+			return nil, err
+		}
+		c.disk = newLRU(opts.DiskMaxBytes, func(e *cacheEntry) {
+			os.Remove(c.diskPath(e.key))
+		})
+	}
+	if opts.PrefetchSegments > 0 && opts.PrefetchWorkers > 0 {
+		// a short queue, so prefetches are only started while workers keep up
+		c.prefetchQueue = make(chan prefetchJob, opts.PrefetchWorkers)
+		c.manifests = make(map[string]*segmentIndex)
+		for i := 0; i < opts.PrefetchWorkers; i++ {
+			go c.prefetchWorker()
+		}
+	}
+	return c, nil
+}
+
+// diskPath names a cached file by the hash of its key, so any video id and
+// file name map to a safe file name.
+func (c *CachedVideoContentService) diskPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.opts.Dir, hex.EncodeToString(sum[:]))
+}
+
+// clearCacheDir removes the files a previous run cached in dir, leaving
+// anything else alone.
+func clearCacheDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".tmp")
+		if _, err := hex.DecodeString(name); err != nil || len(name) != 2*sha256.Size {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to clear cache directory %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+func (c *CachedVideoContentService) ttl(filename string) time.Duration {
+	if strings.HasSuffix(filename, ".mpd") {
+		return c.opts.ManifestTTL
+	}
+	return c.opts.SegmentTTL
+}
+
+// lookup returns a cached copy of the file, or fetches it once for every
+// caller that misses at the same time, and starts prefetching the segments
+// that follow it.
+func (c *CachedVideoContentService) lookup(ctx context.Context, videoId string, filename string) (*cacheEntry, error) {
+	c.schedulePrefetch(videoId, filename)
+	key := path.Join(videoId, filename)
+	if e := c.cached(key, true); e != nil {
+		return e, nil
+	}
+	return c.fetchShared(ctx, videoId, filename, false)
+}
+
+// fetchShared fetches the file into the cache, sharing the fetch with every
+// other caller that wants it meanwhile. Background fetches are not counted
+// as coalesced misses.
+func (c *CachedVideoContentService) fetchShared(ctx context.Context, videoId string, filename string, background bool) (*cacheEntry, error) {
+	key := path.Join(videoId, filename)
+	// the fetch is shared, so it must outlive the caller that started it;
+	// each caller still stops waiting when its own request is cancelled
+	fetchCtx := context.WithoutCancel(ctx)
+	started := false
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		started = true
+		return c.fetch(fetchCtx, videoId, filename)
+	})
+	select {
+	case <-ctx.Done():
+		// nobody may be left to serve a file the fetch opened
+		go func() { closeUnclaimed((<-ch).Err) }()
+		return nil, ctx.Err()
+	case result := <-ch:
+		if !started && !background {
+			c.mu.Lock()
+			c.stats.Coalesced++
+			c.mu.Unlock()
+		}
+		if result.Err != nil {
+			if background {
+				closeUnclaimed(result.Err)
+			}
+			return nil, result.Err
+		}
+		return result.Val.(*cacheEntry), nil
+	}
+}
+
+// cached returns the file from memory, or from disk, promoting it back into
+// memory; nil on a miss. Lookups for viewers are counted in the stats.
+func (c *CachedVideoContentService) cached(key string, count bool) *cacheEntry {
+	now := time.Now()
+	c.mu.Lock()
+	if e := c.memory.get(key, now); e != nil {
+		if count {
+			c.stats.MemoryHits++
+			if e.prefetched {
+				c.stats.PrefetchHits++
+				e.prefetched = false
+			}
+		}
+		c.mu.Unlock()
+		return e
+	}
+	var onDisk *cacheEntry
+	if c.disk != nil {
+		onDisk = c.disk.get(key, now)
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	if onDisk != nil {
+		data, err := os.ReadFile(c.diskPath(key))
+		if err == nil && int64(len(data)) == onDisk.size {
+			e := &cacheEntry{key: key, size: onDisk.size, info: onDisk.info, expires: onDisk.expires, data: data}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if count {
+				c.stats.DiskHits++
+			}
+			if c.gen == gen && e.size <= c.memory.max/cacheMaxEntryFraction {
+				c.stats.Evictions += uint64(c.memory.put(e))
+			}
+			return e
+		}
+		// evicted or invalidated since it was looked up
+	}
+	if count {
+		c.mu.Lock()
+		c.stats.Misses++
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// has reports whether the file is in either tier, without touching the
+// LRU order or the stats.
+func (c *CachedVideoContentService) has(key string) bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.memory.entries[key]; ok && !now.After(e.expires) {
+		return true
+	}
+	if c.disk == nil {
+		return false
+	}
+	e, ok := c.disk.entries[key]
+	return ok && !now.After(e.expires)
+}
+
+// fetch reads the whole file from the content service and caches it.
+func (c *CachedVideoContentService) fetch(ctx context.Context, videoId string, filename string) (*cacheEntry, error) {
+	key := path.Join(videoId, filename)
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	file, info, err := c.VideoContentService.Open(ctx, videoId, filename)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size > c.opts.MaxBytes/cacheMaxEntryFraction {
+		return nil, &tooLargeError{file: file, info: info}
+	}
+	data := make([]byte, info.Size)
+	_, err = io.ReadFull(file, data)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	e := &cacheEntry{key: key, size: info.Size, info: *info, expires: time.Now().Add(c.ttl(filename)), data: data}
+	if len(e.info.Sha256) == 0 {
+		// files stored without a checksum still get an ETag from the cache
+		sum := sha256.Sum256(data)
+		e.info.Sha256 = sum[:]
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		c.stats.Evictions += uint64(c.memory.put(e))
+	}
+	c.mu.Unlock()
+	if c.disk != nil && e.size <= c.disk.max/cacheMaxEntryFraction {
+		c.storeOnDisk(e, gen)
+	}
+	return e, nil
+}
+
+// storeOnDisk writes e to the on-disk tier, unless the file was invalidated
+// since it was fetched.
+func (c *CachedVideoContentService) storeOnDisk(e *cacheEntry, gen uint64) {
+	diskPath := c.diskPath(e.key)
+	if err := os.WriteFile(diskPath+".tmp", e.data, 0644); err != nil {
+		slog.Warn("Failed to cache file on disk", "file", e.key, "error", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		os.Remove(diskPath + ".tmp")
+		return
+	}
+	if err := os.Rename(diskPath+".tmp", diskPath); err != nil {
+		slog.Warn("Failed to cache file on disk", "file", e.key, "error", err)
+		os.Remove(diskPath + ".tmp")
+		return
+	}
+	c.stats.Evictions += uint64(c.disk.put(&cacheEntry{key: e.key, size: e.size, info: e.info, expires: e.expires}))
+}
+
+// invalidate drops the files for which match returns true from both tiers.
+func (c *CachedVideoContentService) invalidate(match func(key string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, tier := range []*lru{c.memory, c.disk} {
+		if tier == nil {
+			continue
+		}
+		for key := range tier.entries {
+			if match(key) {
+				tier.remove(key)
+				c.group.Forget(key)
+			}
+		}
+	}
+}
+
+func (c *CachedVideoContentService) invalidateFile(videoId string, filename string) {
+	key := path.Join(videoId, filename)
+	c.group.Forget(key)
+	c.invalidate(func(k string) bool { return k == key })
+}
+
+// CacheStats returns the cache's counters and current size.
+func (c *CachedVideoContentService) CacheStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.MemoryBytes, stats.MemoryEntries = c.memory.bytes, len(c.memory.entries)
+	if c.disk != nil {
+		stats.DiskBytes, stats.DiskEntries = c.disk.bytes, len(c.disk.entries)
+	}
+	return stats
+}
+
+func (c *CachedVideoContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
+	e, err := c.lookup(ctx, videoId, filename)
+	if errors.Is(err, errTooLargeToCache) {
+		file, _, err := c.openUncached(ctx, videoId, filename, err)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// cached data is shared, so hand out a copy
+	return bytes.Clone(e.data), nil
+}
+
+func (c *CachedVideoContentService) Open(ctx context.Context, videoId string, filename string) (io.ReadSeekCloser, *FileInfo, error) {
+	e, err := c.lookup(ctx, videoId, filename)
+	if errors.Is(err, errTooLargeToCache) {
+		return c.openUncached(ctx, videoId, filename, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info := e.info
+	return nopSeekCloser{bytes.NewReader(e.data)}, &info, nil
+}
+
+// openUncached serves a file too large to cache from the fetch that found it
+// so, or opens it again if another caller already took that.
+func (c *CachedVideoContentService) openUncached(ctx context.Context, videoId string, filename string, err error) (io.ReadSeekCloser, *FileInfo, error) {
+	var tooLarge *tooLargeError
+	if errors.As(err, &tooLarge) {
+		if file, info := tooLarge.claim(); file != nil {
+			return file, info, nil
+		}
+	}
+	return c.VideoContentService.Open(ctx, videoId, filename)
+}
+
+// Stat answers from the cache when the file is in it.
+func (c *CachedVideoContentService) Stat(ctx context.Context, videoId string, filename string) (*FileInfo, error) {
+	key := path.Join(videoId, filename)
+	now := time.Now()
+	c.mu.Lock()
+	e := c.memory.get(key, now)
+	if e == nil && c.disk != nil {
+		e = c.disk.get(key, now)
+	}
+	c.mu.Unlock()
+	if e != nil {
+		info := e.info
+		return &info, nil
+	}
+	return c.VideoContentService.Stat(ctx, videoId, filename)
+}
+
+func (c *CachedVideoContentService) Exists(ctx context.Context, videoId string, filename string) (bool, error) {
+	_, err := c.Stat(ctx, videoId, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *CachedVideoContentService) Write(ctx context.Context, videoId string, filename string, data []byte) error {
+	defer c.invalidateFile(videoId, filename)
+	return c.VideoContentService.Write(ctx, videoId, filename, data)
+}
+
+func (c *CachedVideoContentService) WriteBatch(ctx context.Context, videoId string, files []VideoFile) error {
+	defer c.invalidate(func(key string) bool { return strings.HasPrefix(key, videoId+"/") })
+	return c.VideoContentService.WriteBatch(ctx, videoId, files)
+}
+
+func (c *CachedVideoContentService) Create(ctx context.Context, videoId string, filename string) (io.WriteCloser, error) {
+	w, err := c.VideoContentService.Create(ctx, videoId, filename)
+	if err != nil {
+		return nil, err
+	}
+	return &invalidatingWriter{WriteCloser: w, invalidate: func() { c.invalidateFile(videoId, filename) }}, nil
+}
+
+func (c *CachedVideoContentService) DeleteVideo(ctx context.Context, videoId string) error {
+	defer c.invalidate(func(key string) bool { return strings.HasPrefix(key, videoId+"/") })
+	return c.VideoContentService.DeleteVideo(ctx, videoId)
+}
+
+// invalidatingWriter drops the cached copy once the new file is written.
+type invalidatingWriter struct {
+	io.WriteCloser
+	invalidate func()
+}
+
+func (w *invalidatingWriter) Close() error {
+	defer w.invalidate()
+	return w.WriteCloser.Close()
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+var _ VideoContentService = (*CachedVideoContentService)(nil)
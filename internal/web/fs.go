@@ -3,7 +3,11 @@
 package web
 
 import (
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -20,7 +24,7 @@ func NewFSVideoContentService(baseDir string) (*FSVideoContentService, error) {
 	return &FSVideoContentService{baseDir: baseDir}, nil
 }
 
-func (f *FSVideoContentService) Read(videoId string, filename string) ([]byte, error) {
+func (f *FSVideoContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
 	filePath := filepath.Join(f.baseDir, videoId, filename)
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -32,7 +36,7 @@ func (f *FSVideoContentService) Read(videoId string, filename string) ([]byte, e
 	return data, nil
 }
 
-func (f *FSVideoContentService) Write(videoId string, filename string, data []byte) error {
+func (f *FSVideoContentService) Write(ctx context.Context, videoId string, filename string, data []byte) error {
 	videoDir := filepath.Join(f.baseDir, videoId)
 	if err := os.MkdirAll(videoDir, 0755); err != nil {
 		return fmt.Errorf("failed to create video directory %s: %w", videoDir, err)
@@ -47,5 +51,127 @@ func (f *FSVideoContentService) Write(videoId string, filename string, data []by
 	return nil
 }
 
+func (f *FSVideoContentService) Open(ctx context.Context, videoId string, filename string) (io.ReadSeekCloser, *FileInfo, error) {
+	filePath := filepath.Join(f.baseDir, videoId, filename)
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("file not found: %w", err)
+		}
+		return nil, nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat file %s: %w", filePath, err)
+	}
+	sum, err := fileChecksum(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to hash file %s: %w", filePath, err)
+	}
+	return file, &FileInfo{Size: info.Size(), ModTime: info.ModTime(), Sha256: sum}, nil
+}
+
+// fileChecksum hashes an open file and rewinds it. Local files are stored
+// without checksums, so their ETags come from hashing them.
+func fileChecksum(file *os.File) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// fsWriter writes to a temp file that Close renames into place, so readers
+// never see a partial file.
+type fsWriter struct {
+	ctx  context.Context
+	tmp  *os.File
+	path string
+}
+
+func (w *fsWriter) Write(p []byte) (int, error) {
+	return w.tmp.Write(p)
+}
+
+func (w *fsWriter) Close() error {
+	err := w.tmp.Close()
+	if err == nil {
+		err = w.ctx.Err()
+	}
+	if err == nil {
+		err = os.Rename(w.tmp.Name(), w.path)
+	}
+	if err != nil {
+		os.Remove(w.tmp.Name())
+		return fmt.Errorf("failed to write file %s: %w", w.path, err)
+	}
+	return nil
+}
+
+func (f *FSVideoContentService) Create(ctx context.Context, videoId string, filename string) (io.WriteCloser, error) {
+	videoDir := filepath.Join(f.baseDir, videoId)
+	if err := os.MkdirAll(videoDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create video directory %s: %w", videoDir, err)
+	}
+	tmp, err := os.CreateTemp(videoDir, "."+filename+".tmp-*")
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err != nil {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		return nil, fmt.Errorf("failed to create file %s: %w", filename, err)
+	}
+	return &fsWriter{ctx: ctx, tmp: tmp, path: filepath.Join(videoDir, filename)}, nil
+}
+
+func (f *FSVideoContentService) WriteBatch(ctx context.Context, videoId string, files []VideoFile) error {
+	for _, file := range files {
+		// local writes can't be interrupted, but stop between files
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f.Write(ctx, videoId, file.Name, file.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FSVideoContentService) Stat(ctx context.Context, videoId string, filename string) (*FileInfo, error) {
+	file, info, err := f.Open(ctx, videoId, filename)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	return info, nil
+}
+
+func (f *FSVideoContentService) Exists(ctx context.Context, videoId string, filename string) (bool, error) {
+	_, err := f.Stat(ctx, videoId, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (f *FSVideoContentService) DeleteVideo(ctx context.Context, videoId string) error {
+	videoDir := filepath.Join(f.baseDir, videoId)
+	if filepath.Dir(videoDir) != filepath.Clean(f.baseDir) {
+		return fmt.Errorf("invalid video id %q", videoId)
+	}
+	if err := os.RemoveAll(videoDir); err != nil {
+		return fmt.Errorf("failed to remove video directory %s: %w", videoDir, err)
+	}
+	return nil
+}
+
 // Uncomment the following line to ensure FSVideoContentService implements VideoContentService
 var _ VideoContentService = (*FSVideoContentService)(nil)
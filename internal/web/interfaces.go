@@ -1,19 +1,54 @@
 package web
 
-import "time"
+import (
+	"context"
+	"io"
+	"time"
+)
 
 type VideoMetadata struct {
 	Id         string
 	UploadedAt time.Time
 }
 
+// Services take the context of the request they serve, so a request that
+// is cancelled or times out stops the queries and RPCs made for it.
 type VideoMetadataService interface {
-	Read(id string) (*VideoMetadata, error)
-	List() ([]VideoMetadata, error)
-	Create(videoId string, uploadedAt time.Time) error
+	Read(ctx context.Context, id string) (*VideoMetadata, error)
+	List(ctx context.Context) ([]VideoMetadata, error)
+	Create(ctx context.Context, videoId string, uploadedAt time.Time) error
+	// Delete removes a video's metadata; deleting a missing video is not an error.
+	Delete(ctx context.Context, videoId string) error
 }
 
+// FileInfo describes a stored video file.
+type FileInfo struct {
+	Size    int64
+	ModTime time.Time
+	Sha256  []byte // nil if not known
+}
+
+// VideoFile is one file of a video.
+type VideoFile struct {
+	Name string
+	Data []byte
+}
+
+// Content services return errors wrapping os.ErrNotExist for missing files.
 type VideoContentService interface {
-	Read(videoId string, filename string) ([]byte, error)
-	Write(videoId string, filename string, data []byte) error
+	Read(ctx context.Context, videoId string, filename string) ([]byte, error)
+	Write(ctx context.Context, videoId string, filename string, data []byte) error
+	// Open streams a file instead of reading it whole. The caller must close
+	// the returned reader.
+	Open(ctx context.Context, videoId string, filename string) (io.ReadSeekCloser, *FileInfo, error)
+	// Create streams a file in. It is written once Close returns nil;
+	// cancelling ctx abandons it.
+	Create(ctx context.Context, videoId string, filename string) (io.WriteCloser, error)
+	// WriteBatch writes all files of a video; if it fails, some of them
+	// may have been written.
+	WriteBatch(ctx context.Context, videoId string, files []VideoFile) error
+	Stat(ctx context.Context, videoId string, filename string) (*FileInfo, error)
+	Exists(ctx context.Context, videoId string, filename string) (bool, error)
+	// DeleteVideo removes every file of a video.
+	DeleteVideo(ctx context.Context, videoId string) error
 }
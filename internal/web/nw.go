@@ -3,319 +3,580 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"log"
-	"net"
+	"log/slog"
+	"os"
 	"path"
-	"sort"
-	"strings"
 	"sync"
+	"time"
+	"tritontube/internal/health"
 	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
-// NetworkVideoContentService implements VideoContentService using a network of nodes.
+// how long NewNetworkVideoContentService waits for the first ring from the coordinator
+const ringWaitTimeout = 10 * time.Second
+
+// how long to wait before re-subscribing after the WatchRing stream breaks
+const ringRetryInterval = time.Second
+
+// ErrStorageUnavailable is returned when every node that could serve a
+// request is down or unreachable.
+var ErrStorageUnavailable = errors.New("storage node unavailable")
 
-// VideoContentAdminService must also be run here
+// NetworkVideoContentService implements VideoContentService using a network of nodes.
+// Ring membership is owned by the coordinator (cmd/coordinator); this service
+// subscribes to it and routes every request using the latest ring it pushed.
 type NetworkVideoContentService struct {
-	pb.UnimplementedVideoContentAdminServiceServer
-	aliveNodes []node // always sorted by hash
-	myAddr     string
-	mu         sync.RWMutex
-	// grpcServer *grpc.Server
-	// listener   net.Listener
+	coordinatorAddr string
+	coordinatorConn *grpc.ClientConn
+	cancel          context.CancelFunc
+
+	mu    sync.RWMutex
+	ring  *ring.Ring
+	phase pb.RingPhase
+	// the ring being moved to while joining, or moved from while migrating
+	otherRing *ring.Ring
+	// draining nodes take no new writes; their keys are written to the owner
+	// in writeRing, the ring without them
+	draining  map[string]bool
+	writeRing *ring.Ring
+	nodes     map[string]node // storage clients keyed by address
+
+	rpc    RPCOptions
+	health *health.Checker
+	ready  chan struct{}
 }
 
 type node struct {
 	addr   string
-	hash   uint64
 	client pb.StorageServiceClient
 	conn   *grpc.ClientConn
 }
 
-func NewNetworkVideoContentService(options string) (*NetworkVideoContentService, error) {
-	var service *NetworkVideoContentService
-	optionStrings := strings.Split(options, ",")
-	if len(optionStrings) > 0 {
-		service = &NetworkVideoContentService{
-			aliveNodes: make([]node, 0), // init with 0 alive nodes
-			myAddr:     optionStrings[0],
-		}
-		if len(optionStrings) > 1 {
-			// add the storage servers -- bootstrap
-			for _, option := range optionStrings[1:] {
-				// fmt.Printf("Adding node %d : %s", id, option)
-				err := service.bootstrap(option)
-				if err != nil {
-					fmt.Printf("Unable to add storage %s", option)
-					return nil, err
-				}
-			}
-		}
-		// run a grpc server here
-		grpcServer := grpc.NewServer()
-		pb.RegisterVideoContentAdminServiceServer(grpcServer, service)
-		lis, err := net.Listen("tcp", optionStrings[0])
-		if err != nil {
-			fmt.Printf("Failed to listen: %v", err)
-			return nil, err
+// NewNetworkVideoContentService connects to the coordinator at options and
+// waits for the first ring before returning. rpcOptions sets the deadlines,
+// retries and connection settings used with storage nodes.
+func NewNetworkVideoContentService(options string, rpcOptions RPCOptions) (*NetworkVideoContentService, error) {
+	if options == "" {
+		return nil, errors.New("invalid options: coordinator address is required")
+	}
+	conn, err := grpc.NewClient(options, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to coordinator %s: %w", options, err)
+	}
+	service := &NetworkVideoContentService{
+		coordinatorAddr: options,
+		coordinatorConn: conn,
+		ring:            ring.New(0, nil),
+		nodes:           make(map[string]node),
+		rpc:             rpcOptions,
+		health:          health.NewChecker(),
+		ready:           make(chan struct{}),
+	}
+	// don't wait out the reconnect backoff once a node is reachable again
+	service.health.OnRecover(func(addr string) {
+		service.mu.RLock()
+		defer service.mu.RUnlock()
+		if n, ok := service.nodes[addr]; ok {
+			n.conn.ResetConnectBackoff()
 		}
-		// service.grpcServer = grpcServer
-		// service.listener = lis
-		go func() {
-
-			log.Printf("gRPC server listening on %s", optionStrings[0])
-			if err := grpcServer.Serve(lis); err != nil {
-				fmt.Printf("Failed to serve: %v", err)
-				// TODO: maybe return nil here?
-			}
-		}()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	service.cancel = cancel
+	go service.watchRing(ctx, pb.NewVideoContentAdminServiceClient(conn))
 
-		// and return an object for NetworkVideoContentService
+	select {
+	case <-service.ready:
 		return service, nil
-
-	} else {
-		return nil, errors.New("invalid options")
+	case <-time.After(ringWaitTimeout):
+		service.Close()
+		return nil, fmt.Errorf("timed out waiting for ring from coordinator %s", options)
 	}
 }
 
-func (nws *NetworkVideoContentService) Read(videoId string, filename string) ([]byte, error) {
-
-	ctx := context.Background()
-
-	videoHash := hashStringToUint64(path.Join(videoId, filename))
-	node, err := nws.getNodeForHash(videoHash)
+func (nws *NetworkVideoContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
+	// while the ring is changing the file may still be on the old owner or
+	// already on the new one, so try both
+	nodes, skipped, err := nws.getReadNodesForKey(path.Join(videoId, filename))
 	if err != nil {
 		return nil, err
 	}
-	response, err := node.client.Read(ctx, &pb.ReadRequest{
-		VideoId:  videoId,
-		FileName: filename,
-	})
+	// if a node that may hold the file cannot be reached, a miss on the
+	// others does not mean the file is gone
+	unavailable, notFound := skipped, 0
+	for idx, node := range nodes {
+		var response *pb.ReadResponse
+		err := nws.rpc.callWithRetries(ctx, func(ctx context.Context) error {
+			var err error
+			response, err = node.client.Read(ctx, &pb.ReadRequest{
+				VideoId:  videoId,
+				FileName: filename,
+			})
+			return err
+		})
+		if err == nil {
+			err = verifyChecksum(response)
+		}
+		if err == nil {
+			return response.FileData, nil
+		}
+		if ctx.Err() != nil {
+			// the caller gave up, so don't try the other nodes
+			return nil, ctx.Err()
+		}
+		switch status.Code(err) {
+		case codes.Unavailable:
+			unavailable++
+		case codes.NotFound:
+			notFound++
+		}
+		if idx == len(nodes)-1 {
+			slog.Log(ctx, rpcLogLevel(err), "Read RPC failed", "node", node.addr, "file", path.Join(videoId, filename), "error", err)
+			return nil, lookupError(err, unavailable, notFound, len(nodes))
+		}
+		slog.Log(ctx, rpcLogLevel(err), "Read RPC failed, falling back", "node", node.addr, "fallback", nodes[idx+1].addr, "file", path.Join(videoId, filename), "error", err)
+	}
+	return nil, ring.ErrNoNodes
+}
+
+// Stat asks the nodes that may hold the file for its size, write time and
+// checksum, the same way Read looks for it.
+func (nws *NetworkVideoContentService) Stat(ctx context.Context, videoId string, filename string) (*FileInfo, error) {
+	nodes, skipped, err := nws.getReadNodesForKey(path.Join(videoId, filename))
 	if err != nil {
-		fmt.Printf("Read RPC failed: %v", err)
 		return nil, err
 	}
-	return response.FileData, nil
+	unavailable, notFound := skipped, 0
+	for idx, node := range nodes {
+		var response *pb.StatResponse
+		err := nws.rpc.callWithRetries(ctx, func(ctx context.Context) error {
+			var err error
+			response, err = node.client.Stat(ctx, &pb.StatRequest{
+				VideoId:  videoId,
+				FileName: filename,
+			})
+			return err
+		})
+		if err == nil {
+			return &FileInfo{
+				Size:    response.Size,
+				ModTime: time.UnixMilli(response.MtimeUnixMs),
+				Sha256:  response.Sha256,
+			}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		switch status.Code(err) {
+		case codes.Unavailable:
+			unavailable++
+		case codes.NotFound:
+			notFound++
+		}
+		if idx == len(nodes)-1 {
+			return nil, lookupError(err, unavailable, notFound, len(nodes))
+		}
+	}
+	return nil, ring.ErrNoNodes
+}
+
+func (nws *NetworkVideoContentService) Exists(ctx context.Context, videoId string, filename string) (bool, error) {
+	_, err := nws.Stat(ctx, videoId, filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
-func (nws *NetworkVideoContentService) Write(videoId string, filename string, data []byte) error {
-	ctx := context.Background()
+// DeleteVideo deletes the video from every node, since its files are spread
+// across all of them.
+func (nws *NetworkVideoContentService) DeleteVideo(ctx context.Context, videoId string) error {
+	nws.mu.RLock()
+	nodes := make([]node, 0, len(nws.nodes))
+	for _, n := range nws.nodes {
+		nodes = append(nodes, n)
+	}
+	nws.mu.RUnlock()
 
-	videoHash := hashStringToUint64(path.Join(videoId, filename))
-	node, err := nws.getNodeForHash(videoHash)
+	var wg sync.WaitGroup
+	errs := make([]error, len(nodes))
+	for i, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, nws.rpc.WriteTimeout)
+			defer cancel()
+			_, err := n.client.DeleteVideo(ctx, &pb.DeleteVideoRequest{VideoId: videoId})
+			if err != nil {
+				slog.WarnContext(ctx, "DeleteVideo RPC failed", "node", n.addr, "video", videoId, "error", err)
+				if status.Code(err) == codes.Unavailable {
+					err = fmt.Errorf("%w: %v", ErrStorageUnavailable, err)
+				}
+				errs[i] = fmt.Errorf("delete %s from %s: %w", videoId, n.addr, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (nws *NetworkVideoContentService) Write(ctx context.Context, videoId string, filename string, data []byte) error {
+	node, next, err := nws.getWriteNodesForKey(path.Join(videoId, filename))
 	if err != nil {
 		return err
 	}
 
-	_, err = node.client.Write(ctx, &pb.WriteRequest{
+	sum := sha256.Sum256(data)
+	request := &pb.WriteRequest{
 		VideoId:  videoId,
 		FileName: filename,
 		FileData: data,
-	})
+		Sha256:   sum[:],
+	}
+	// writes are not retried: the caller decides whether to write again
+	writeCtx, cancel := context.WithTimeout(ctx, nws.rpc.WriteTimeout)
+	defer cancel()
+	_, err = node.client.Write(writeCtx, request)
 	if err != nil {
-		fmt.Printf("Write RPC failed: %v", err)
+		slog.WarnContext(ctx, "Write RPC failed", "node", node.addr, "file", path.Join(videoId, filename), "error", err)
+		if status.Code(err) == codes.Unavailable {
+			return fmt.Errorf("%w: %v", ErrStorageUnavailable, err)
+		}
 		return err
 	}
+	if next != nil {
+		// the coordinator may already have copied the files it knows of, so
+		// the joining owner must get this write too
+		nextCtx, cancel := context.WithTimeout(ctx, nws.rpc.WriteTimeout)
+		defer cancel()
+		if _, err := next.client.Write(nextCtx, request); err != nil {
+			slog.WarnContext(ctx, "Write RPC to joining owner failed", "node", next.addr, "file", path.Join(videoId, filename), "error", err)
+			return writeError(err)
+		}
+	}
 	return nil
 }
 
-func (nws *NetworkVideoContentService) ListNodes(ctx context.Context, rr *pb.ListNodesRequest) (*pb.ListNodesResponse, error) {
-	//assumes a sorted list
-	nws.mu.RLock()
-	defer nws.mu.RUnlock()
-	respList := make([]string, 0)
-	for _, node := range nws.aliveNodes {
-		respList = append(respList, node.addr)
+// WriteBatch groups the files by the node that takes their writes, and by
+// their joining owner too while a node joins, and streams each group to its
+// node as one batch, all nodes in parallel. Each node commits its whole batch
+// or nothing; if any node fails, the others' streams are cancelled, though a
+// node that already committed keeps its files.
+func (nws *NetworkVideoContentService) WriteBatch(ctx context.Context, videoId string, files []VideoFile) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(map[string][]*pb.WriteRequest)
+	joining := make(map[string][]*pb.WriteRequest)
+	nodes := make(map[string]node)
+	for _, file := range files {
+		owner, next, err := nws.getWriteNodesForKey(path.Join(videoId, file.Name))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(file.Data)
+		request := &pb.WriteRequest{
+			VideoId:  videoId,
+			FileName: file.Name,
+			FileData: file.Data,
+			Sha256:   sum[:],
+		}
+		batches[owner.addr] = append(batches[owner.addr], request)
+		nodes[owner.addr] = owner
+		if next != nil {
+			joining[next.addr] = append(joining[next.addr], request)
+			nodes[next.addr] = *next
+		}
 	}
-	return &pb.ListNodesResponse{
-		Nodes: respList,
-	}, nil
-}
 
-func (nws *NetworkVideoContentService) bootstrap(addrs string) error {
-	newNodeHash := hashStringToUint64(addrs)
-	// create a new node
-	conn, err := grpc.NewClient(addrs, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		fmt.Printf("Failed to connect to server: %v", err)
-		return err
+	var wg sync.WaitGroup
+	var errsMu sync.Mutex
+	errs := make([]error, 0)
+	send := func(addr string, requests []*pb.WriteRequest, msg string) {
+		defer wg.Done()
+		if err := nws.writeBatch(ctx, nodes[addr], requests); err != nil {
+			slog.WarnContext(ctx, msg, "node", addr, "video", videoId, "files", len(requests), "error", err)
+			errsMu.Lock()
+			errs = append(errs, fmt.Errorf("write %d files to %s: %w", len(requests), addr, writeError(err)))
+			errsMu.Unlock()
+			cancel()
+		}
 	}
-	newClient := pb.NewStorageServiceClient(conn)
-	newNode := node{
-		addr:   addrs,
-		hash:   newNodeHash,
-		client: newClient,
-		conn:   conn,
+	for addr, requests := range batches {
+		wg.Add(1)
+		go send(addr, requests, "WriteBatch RPC failed")
 	}
-	nws.mu.Lock()
-	defer nws.mu.Unlock()
-	nws.aliveNodes = append(nws.aliveNodes, newNode)
-	sort.Slice(nws.aliveNodes, func(i, j int) bool {
-		return nws.aliveNodes[i].hash < nws.aliveNodes[j].hash
-	})
-	return nil
+	for addr, requests := range joining {
+		wg.Add(1)
+		go send(addr, requests, "WriteBatch RPC to joining owner failed")
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
-func (nws *NetworkVideoContentService) AddNode(ctx context.Context, rr *pb.AddNodeRequest) (*pb.AddNodeResponse, error) {
-
-	// fmt.Printf("Adding node %s", rr.NodeAddress)
-	migratedFileCount := 0
-	q_ctx := context.Background() // should a new context be created?
-	newNodeHash := hashStringToUint64(rr.NodeAddress)
-	// create a new node
-	conn, err := grpc.NewClient(rr.NodeAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// writeBatch streams requests to n and waits for it to commit them, allowing
+// the write deadline for each file.
+func (nws *NetworkVideoContentService) writeBatch(ctx context.Context, n node, requests []*pb.WriteRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, nws.rpc.WriteTimeout*time.Duration(len(requests)))
+	defer cancel()
+	stream, err := n.client.WriteBatch(ctx)
 	if err != nil {
-		fmt.Printf("Failed to connect to server: %v", err)
-		return nil, err
+		return err
 	}
-	newClient := pb.NewStorageServiceClient(conn)
-	newNode := node{
-		addr:   rr.NodeAddress,
-		hash:   newNodeHash,
-		client: newClient,
-		conn:   conn,
-	}
-	// get the node's location in the ring
-	successorNode, err := nws.getNodeForHash(newNodeHash)
-	if err == nil {
-		// list all the data from that node if node is found
-		data, err := successorNode.client.List(q_ctx, &pb.ListRequest{})
-		if err != nil {
-			conn.Close()
-			return nil, err
+	for _, request := range requests {
+		// on a failed send the stream's status comes from CloseAndRecv
+		if err := stream.Send(request); err != nil {
+			break
 		}
-		dataToBeMoved := getDataBelongingToNode(data.Files, newNodeHash, successorNode.hash)
-		migratedFileCount = len(dataToBeMoved)
-		// fmt.Printf("add node: Moving data between %s -> %s\n", successorNode.addr, rr.NodeAddress)
-		moveDataBetweenNodes(successorNode.client, newClient, dataToBeMoved)
 	}
-	nws.mu.Lock()
-	defer nws.mu.Unlock()
-	//add the node and sort the list
-	nws.aliveNodes = append(nws.aliveNodes, newNode)
-	sort.Slice(nws.aliveNodes, func(i, j int) bool {
-		return nws.aliveNodes[i].hash < nws.aliveNodes[j].hash
-	})
-	return &pb.AddNodeResponse{MigratedFileCount: int32(migratedFileCount)}, nil
-
-}
-
-func (nws *NetworkVideoContentService) RemoveNode(ctx context.Context, rr *pb.RemoveNodeRequest) (*pb.RemoveNodeResponse, error) {
-
-	q_ctx := context.Background() // should a new context be created?
-	migratedFileCount := 0
-	// get the idx, currentNode and the successorNode index from the list
-	currentNodeIdx, err := nws.getNodeIndex(rr.NodeAddress)
+	response, err := stream.CloseAndRecv()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	nws.mu.Lock()
-	defer nws.mu.Unlock()
-	if len(nws.aliveNodes) > 1 {
-		currentNode, successorNode := nws.aliveNodes[currentNodeIdx], nws.aliveNodes[(currentNodeIdx+1)%len(nws.aliveNodes)]
-		// move data to its successor if it exists
-		data, err := currentNode.client.List(q_ctx, &pb.ListRequest{}) // TODO: can I pass the same context?
-		if err == nil {
-			fmt.Printf("rem node: Moving data between %s -> %s\n", currentNode.addr, successorNode.addr)
-			moveDataBetweenNodes(currentNode.client, successorNode.client, data.Files)
-			migratedFileCount = len(data.Files)
-		} else {
-			fmt.Printf("cant get list from node")
-		}
+	if int(response.FilesWritten) != len(requests) {
+		return fmt.Errorf("node wrote %d of %d files", response.FilesWritten, len(requests))
 	}
-	// close the connection and remove node c.conn.close()
-	nws.aliveNodes[currentNodeIdx].conn.Close()
-	nws.aliveNodes = append(nws.aliveNodes[:currentNodeIdx], nws.aliveNodes[currentNodeIdx+1:]...)
-	return &pb.RemoveNodeResponse{MigratedFileCount: int32(migratedFileCount)}, nil
+	return nil
 }
 
-func hashStringToUint64(s string) uint64 {
-	sum := sha256.Sum256([]byte(s))
-	return binary.BigEndian.Uint64(sum[:8])
+// Close stops watching the ring and closes every connection.
+func (nws *NetworkVideoContentService) Close() {
+	nws.cancel()
+	nws.health.Close()
+	nws.coordinatorConn.Close()
+	nws.mu.Lock()
+	defer nws.mu.Unlock()
+	for addr, n := range nws.nodes {
+		n.conn.Close()
+		delete(nws.nodes, addr)
+	}
 }
 
-func getDataBelongingToNode(data []string, nodeHash uint64, successorHash uint64) []string {
-	// must handle the wraparound case -
-	// discard the data that belongs to the successor node
-	// make sure nodeHash and successorHash are distinct before calling this function
-	filteredList := make([]string, 0)
-	for _, file := range data {
-		// fmt.Printf("file: %s\n", file)
-		fileHash := hashStringToUint64(file)
-		if nodeHash < successorHash {
-			// non wraparound case
-			if !(fileHash <= successorHash && fileHash > nodeHash) {
-				// fmt.Printf("append: yes")
-				filteredList = append(filteredList, file)
+// watchRing keeps a WatchRing subscription to the coordinator open for the
+// lifetime of the service, re-subscribing whenever the stream breaks. Each
+// ring is acknowledged once requests are routed with it, which the
+// coordinator waits for before moving data.
+func (nws *NetworkVideoContentService) watchRing(ctx context.Context, client pb.VideoContentAdminServiceClient) {
+	for ctx.Err() == nil {
+		stream, err := client.WatchRing(ctx)
+		if err == nil {
+			for {
+				update, err := stream.Recv()
+				if err == nil {
+					nws.applyRing(update)
+					err = stream.Send(&pb.WatchRingRequest{AppliedVersion: update.Version})
+				}
+				if err != nil {
+					slog.Warn("WatchRing stream broken", "coordinator", nws.coordinatorAddr, "error", err)
+					break
+				}
 			}
 		} else {
-			// wrap around case
-			if fileHash <= nodeHash && fileHash > successorHash {
-				// fmt.Printf("append: yes")
-				filteredList = append(filteredList, file)
-			}
+			slog.Warn("WatchRing failed", "coordinator", nws.coordinatorAddr, "error", err)
 		}
+		time.Sleep(ringRetryInterval)
 	}
-	return filteredList
 }
 
-func (nws *NetworkVideoContentService) getNodeIndex(addr string) (int, error) {
+// applyRing switches routing to the ring in update, dialing new members and
+// closing connections to nodes that left. The coordinator sends snapshots in
+// order, so the latest one received always wins.
+func (nws *NetworkVideoContentService) applyRing(update *pb.RingUpdate) {
+	nws.mu.Lock()
+	defer nws.mu.Unlock()
 
-	nws.mu.RLock()
-	defer nws.mu.RUnlock()
-	for idx, node := range nws.aliveNodes {
-		if node.addr == addr {
-			return idx, nil
+	addrs := make([]string, 0, len(update.Nodes)+len(update.NextNodes)+len(update.PreviousNodes))
+	addrs = append(addrs, update.Nodes...)
+	addrs = append(addrs, update.NextNodes...)
+	addrs = append(addrs, update.PreviousNodes...)
+	members := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		if members[addr] {
+			continue
+		}
+		members[addr] = true
+		if _, ok := nws.nodes[addr]; ok {
+			continue
+		}
+		conn, err := grpc.NewClient(addr, nws.rpc.dialOptions()...)
+		if err != nil {
+			slog.Error("Failed to connect to storage node", "node", addr, "error", err)
+			continue
+		}
+		nws.nodes[addr] = node{addr: addr, client: pb.NewStorageServiceClient(conn), conn: conn}
+	}
+	for addr, n := range nws.nodes {
+		if !members[addr] {
+			n.conn.Close()
+			delete(nws.nodes, addr)
+		}
+	}
+	nws.health.Set(addrs)
+	if update.Version != nws.ring.Version {
+		slog.Info("Switching ring version", "version", update.Version, "phase", update.Phase.String(), "nodes", len(update.Nodes))
+	}
+	nws.ring = ring.New(update.Version, update.Nodes)
+	nws.phase = update.Phase
+	switch update.Phase {
+	case pb.RingPhase_RING_PHASE_JOINING:
+		nws.otherRing = ring.New(update.Version, update.NextNodes)
+	case pb.RingPhase_RING_PHASE_MIGRATING:
+		nws.otherRing = ring.New(update.Version, update.PreviousNodes)
+	default:
+		nws.otherRing = nil
+	}
+	nws.draining = make(map[string]bool, len(update.DrainingNodes))
+	for _, addr := range update.DrainingNodes {
+		nws.draining[addr] = true
+	}
+	writable := make([]string, 0, len(update.Nodes))
+	for _, addr := range update.Nodes {
+		if !nws.draining[addr] {
+			writable = append(writable, addr)
 		}
 	}
-	return -1, errors.New("node not found")
+	nws.writeRing = ring.New(update.Version, writable)
 
+	select {
+	case <-nws.ready:
+	default:
+		close(nws.ready)
+	}
 }
 
-func moveDataBetweenNodes(srcNode pb.StorageServiceClient, destNode pb.StorageServiceClient, data []string) {
-
-	// read data from source and write to destination and remove from the source
-	for idx, file := range data {
-		videoID := path.Dir(file)   // "videoId"
-		fileName := path.Base(file) // "file.mxx"
-		fileData, err := srcNode.Read(context.Background(), &pb.ReadRequest{VideoId: videoID, FileName: fileName})
-		if err != nil {
-			fmt.Printf("Read GRPC failed while moving data for file %d", idx) // Does it have to be fatal?
+// getReadNodesForKey returns the nodes that may hold key: its owner, its
+// owner in the ring being moved to or from, and the node taking its writes
+// while the owner drains. Suspect nodes are tried last and down nodes are
+// skipped; the number skipped is returned too.
+func (nws *NetworkVideoContentService) getReadNodesForKey(key string) ([]node, int, error) {
+	nws.mu.RLock()
+	defer nws.mu.RUnlock()
+	owner, err := nws.connectedOwner(nws.ring, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	candidates := []node{owner}
+	for _, r := range []*ring.Ring{nws.otherRing, nws.writeRing} {
+		if r == nil {
+			continue
 		}
-		_, err = destNode.Write(context.Background(), &pb.WriteRequest{VideoId: videoID, FileName: fileName, FileData: fileData.FileData})
-		if err != nil {
-			fmt.Printf("Write GRPC failed while moving data for file %d", idx) // Does it have to be fatal?
+		other, err := nws.connectedOwner(r, key)
+		if err == nil && !containsAddr(candidates, other.addr) {
+			candidates = append(candidates, other)
 		}
-		_, err = srcNode.Remove(context.Background(), &pb.RemoveRequest{VideoId: videoID, FileName: fileName})
-		if err != nil {
-			fmt.Printf("Remove GRPC failed while moving data for file %d", idx) // Does it have to be fatal?
+	}
+	nodes := make([]node, 0, len(candidates))
+	suspect := make([]node, 0)
+	for _, n := range candidates {
+		switch nws.health.State(n.addr) {
+		case health.Up:
+			nodes = append(nodes, n)
+		case health.Suspect:
+			suspect = append(suspect, n)
 		}
 	}
+	nodes = append(nodes, suspect...)
+	if len(nodes) == 0 {
+		return nil, 0, fmt.Errorf("%w: %s is down", ErrStorageUnavailable, owner.addr)
+	}
+	return nodes, len(candidates) - len(nodes), nil
 }
 
-func (nws *NetworkVideoContentService) getNodeForHash(hash uint64) (*node, error) {
-	// fmt.Printf("Nodes alive: %d", len(nws.aliveNodes))
-	//assumes a sorted list
+// getWriteNodesForKey returns the node that takes writes for key and, while
+// a node is joining, the node that will own it next if that is a different
+// node that is not down.
+func (nws *NetworkVideoContentService) getWriteNodesForKey(key string) (node, *node, error) {
 	nws.mu.RLock()
 	defer nws.mu.RUnlock()
-	if len(nws.aliveNodes) == 0 {
-		return nil, errors.New("no live nodes")
+	owner, err := nws.connectedOwner(nws.ring, key)
+	if err != nil {
+		return node{}, nil, err
 	}
-	nodeToReturn := &nws.aliveNodes[0] // to loop around
-	for _, node := range nws.aliveNodes {
-		if node.hash > hash {
-			nodeToReturn = &node
-			break
+	if nws.draining[owner.addr] {
+		owner, err = nws.connectedOwner(nws.writeRing, key)
+		if err != nil {
+			return node{}, nil, err
+		}
+	}
+	if nws.health.State(owner.addr) == health.Down {
+		return node{}, nil, fmt.Errorf("%w: %s is down", ErrStorageUnavailable, owner.addr)
+	}
+	if nws.phase != pb.RingPhase_RING_PHASE_JOINING {
+		return owner, nil, nil
+	}
+	next, err := nws.connectedOwner(nws.otherRing, key)
+	if err != nil || next.addr == owner.addr || nws.draining[next.addr] || nws.health.State(next.addr) == health.Down {
+		return owner, nil, nil
+	}
+	return owner, &next, nil
+}
+
+// connectedOwner returns the owner of key in r. Must be called with mu held.
+func (nws *NetworkVideoContentService) connectedOwner(r *ring.Ring, key string) (node, error) {
+	owner, err := r.NodeForKey(key)
+	if err != nil {
+		return node{}, err
+	}
+	n, ok := nws.nodes[owner.Addr]
+	if !ok {
+		return node{}, fmt.Errorf("no connection to storage node %s", owner.Addr)
+	}
+	return n, nil
+}
+
+// rpcLogLevel logs a file a node does not have, which is usually answered
+// with a 404 or found on another node, below other failed lookups.
+func rpcLogLevel(err error) slog.Level {
+	if status.Code(err) == codes.NotFound {
+		return slog.LevelDebug
+	}
+	return slog.LevelWarn
+}
+
+// lookupError turns the last error of a lookup across the nodes that may
+// hold a file into ErrStorageUnavailable if any of them could not be asked,
+// or into a not-found error if none of them has it.
+func lookupError(err error, unavailable int, notFound int, tried int) error {
+	if unavailable > 0 {
+		return fmt.Errorf("%w: %v", ErrStorageUnavailable, err)
+	}
+	if notFound == tried {
+		return fmt.Errorf("file not found: %w", os.ErrNotExist)
+	}
+	return err
+}
+
+// verifyChecksum checks a read against the checksum the storage node stored
+// when the file was written. Files written before checksums were kept have
+// none and are not checked.
+func verifyChecksum(response *pb.ReadResponse) error {
+	if len(response.Sha256) == 0 {
+		return nil
+	}
+	sum := sha256.Sum256(response.FileData)
+	if !bytes.Equal(sum[:], response.Sha256) {
+		return fmt.Errorf("checksum mismatch: stored %x, data hashes to %x", response.Sha256, sum)
+	}
+	return nil
+}
+
+func containsAddr(nodes []node, addr string) bool {
+	for _, n := range nodes {
+		if n.addr == addr {
+			return true
 		}
 	}
-	return nodeToReturn, nil
+	return false
 }
 
 // Uncomment the following line to ensure NetworkVideoContentService implements VideoContentService
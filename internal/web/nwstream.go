@@ -0,0 +1,358 @@
+// Streaming reads and writes of the network content service
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"path"
+	"time"
+	pb "tritontube/internal/proto"
+	"tritontube/internal/ring"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamChunkSize is the most file data sent in one WriteStream message.
+const streamChunkSize = 256 << 10
+
+// Open finds the file on the nodes that may hold it, the same way Read does,
+// and streams it from the first one that has it.
+func (nws *NetworkVideoContentService) Open(ctx context.Context, videoId string, filename string) (io.ReadSeekCloser, *FileInfo, error) {
+	nodes, skipped, err := nws.getReadNodesForKey(path.Join(videoId, filename))
+	if err != nil {
+		return nil, nil, err
+	}
+	unavailable, notFound := skipped, 0
+	for idx, node := range nodes {
+		f := &nwFile{ctx: ctx, rpc: nws.rpc, node: node, videoId: videoId, filename: filename}
+		first, err := f.openStream(0)
+		if err == nil {
+			f.info = FileInfo{
+				Size:    first.Size,
+				ModTime: time.UnixMilli(first.MtimeUnixMs),
+				Sha256:  first.Sha256,
+			}
+			err = f.received(first.Data)
+		}
+		if err == nil {
+			info := f.info
+			return f, &info, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		switch status.Code(err) {
+		case codes.Unavailable:
+			unavailable++
+		case codes.NotFound:
+			notFound++
+		}
+		if idx == len(nodes)-1 {
+			slog.Log(ctx, rpcLogLevel(err), "ReadStream RPC failed", "node", node.addr, "file", path.Join(videoId, filename), "error", err)
+			return nil, nil, lookupError(err, unavailable, notFound, len(nodes))
+		}
+		slog.Log(ctx, rpcLogLevel(err), "ReadStream RPC failed, falling back", "node", node.addr, "fallback", nodes[idx+1].addr, "file", path.Join(videoId, filename), "error", err)
+	}
+	return nil, nil, ring.ErrNoNodes
+}
+
+// nwFile reads a file from one storage node with ReadStream. Seeking only
+// moves the position; the next Read reopens the stream there unless the
+// data is already on its way.
+type nwFile struct {
+	ctx      context.Context
+	rpc      RPCOptions
+	node     node
+	videoId  string
+	filename string
+	info     FileInfo
+
+	pos       int64 // position of the next Read
+	stream    pb.StorageService_ReadStreamClient
+	cancel    context.CancelFunc
+	buf       []byte    // received but not yet read
+	streamEnd int64     // position just past buf
+	hash      hash.Hash // of everything received, if the stream started at 0
+}
+
+// openStream starts a stream at offset and receives its first message,
+// retrying failures another attempt may fix.
+func (f *nwFile) openStream(offset int64) (*pb.ReadStreamResponse, error) {
+	f.closeStream()
+	var first *pb.ReadStreamResponse
+	err := f.rpc.retry(f.ctx, func() error {
+		var ctx context.Context
+		ctx, f.cancel = context.WithCancel(f.ctx)
+		stream, err := f.node.client.ReadStream(ctx, &pb.ReadStreamRequest{
+			VideoId:  f.videoId,
+			FileName: f.filename,
+			Offset:   offset,
+		})
+		if err == nil {
+			f.stream = stream
+			first, err = f.recv()
+		}
+		if err != nil {
+			f.closeStream()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.streamEnd = offset
+	f.hash = nil
+	if offset == 0 {
+		f.hash = sha256.New()
+	}
+	return first, nil
+}
+
+// recv receives the next message, giving up if the node sends nothing for
+// the read timeout.
+func (f *nwFile) recv() (*pb.ReadStreamResponse, error) {
+	timer := time.AfterFunc(f.rpc.ReadTimeout, f.cancel)
+	response, err := f.stream.Recv()
+	if !timer.Stop() && err != nil {
+		return nil, status.Errorf(codes.DeadlineExceeded, "%s sent nothing for %v", f.node.addr, f.rpc.ReadTimeout)
+	}
+	return response, err
+}
+
+// received queues data that arrived on the stream. A file read from the
+// start is checked against its checksum before its last chunk is handed
+// out, so a corrupt file is cut short instead of served whole.
+func (f *nwFile) received(data []byte) error {
+	if f.streamEnd+int64(len(data)) > f.info.Size {
+		f.closeStream()
+		return fmt.Errorf("%s/%s from %s is longer than its size", f.videoId, f.filename, f.node.addr)
+	}
+	f.buf = data
+	f.streamEnd += int64(len(data))
+	if f.hash == nil {
+		return nil
+	}
+	f.hash.Write(data)
+	if f.streamEnd == f.info.Size && len(f.info.Sha256) > 0 && !bytes.Equal(f.hash.Sum(nil), f.info.Sha256) {
+		f.closeStream()
+		return fmt.Errorf("checksum mismatch reading %s/%s from %s", f.videoId, f.filename, f.node.addr)
+	}
+	return nil
+}
+
+// Read logs its failures, since http.ServeContent only drops the connection.
+func (f *nwFile) Read(p []byte) (int, error) {
+	n, err := f.read(p)
+	if err != nil && err != io.EOF {
+		slog.WarnContext(f.ctx, "ReadStream RPC failed", "node", f.node.addr, "error", err)
+	}
+	return n, err
+}
+
+func (f *nwFile) read(p []byte) (int, error) {
+	if f.pos >= f.info.Size {
+		return 0, io.EOF
+	}
+	if start := f.streamEnd - int64(len(f.buf)); f.stream != nil && f.pos >= start && f.pos <= f.streamEnd {
+		// skip ahead within what was already received
+		f.buf = f.buf[f.pos-start:]
+	} else {
+		first, err := f.openStream(f.pos)
+		if err != nil {
+			return 0, fmt.Errorf("read %s/%s from %s: %w", f.videoId, f.filename, f.node.addr, err)
+		}
+		if first.Size != f.info.Size || !bytes.Equal(first.Sha256, f.info.Sha256) {
+			f.closeStream()
+			return 0, fmt.Errorf("%s/%s changed on %s while it was being read", f.videoId, f.filename, f.node.addr)
+		}
+		if err := f.received(first.Data); err != nil {
+			return 0, err
+		}
+	}
+	for len(f.buf) == 0 {
+		response, err := f.recv()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			f.closeStream()
+			return 0, fmt.Errorf("read %s/%s from %s: %w", f.videoId, f.filename, f.node.addr, err)
+		}
+		if err := f.received(response.Data); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	f.pos += int64(n)
+	if f.streamEnd == f.info.Size && len(f.buf) == 0 {
+		// the node ends the stream right after the last chunk; wait for that
+		// so the RPC finishes cleanly rather than being cancelled
+		f.recv()
+		f.closeStream()
+	}
+	return n, nil
+}
+
+func (f *nwFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.Size
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *nwFile) Close() error {
+	f.closeStream()
+	return nil
+}
+
+func (f *nwFile) closeStream() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+	f.stream, f.cancel, f.buf = nil, nil, nil
+}
+
+// Create streams the file to the node that takes its writes and, while a
+// node is joining, to the node that will own it next. The write fails if
+// either of them does.
+func (nws *NetworkVideoContentService) Create(ctx context.Context, videoId string, filename string) (io.WriteCloser, error) {
+	owner, next, err := nws.getWriteNodesForKey(path.Join(videoId, filename))
+	if err != nil {
+		return nil, err
+	}
+	// writes are not retried: the caller decides whether to write again
+	ctx, cancel := context.WithTimeout(ctx, nws.rpc.WriteTimeout)
+	w := &nwWriter{ctx: ctx, videoId: videoId, filename: filename, cancel: cancel, owner: owner, hash: sha256.New()}
+	w.stream, err = owner.client.WriteStream(ctx)
+	if err != nil {
+		cancel()
+		return nil, writeError(err)
+	}
+	if next != nil {
+		// the coordinator may already have copied the files it knows of, so
+		// the joining owner must get this write too
+		if w.nextStream, err = next.client.WriteStream(ctx); err != nil {
+			slog.WarnContext(ctx, "WriteStream RPC to joining owner failed", "node", next.addr, "file", path.Join(videoId, filename), "error", err)
+			cancel()
+			return nil, writeError(err)
+		}
+		w.next = *next
+	}
+	return w, nil
+}
+
+// nwWriter sends a file to WriteStream in chunks of at most streamChunkSize.
+type nwWriter struct {
+	ctx      context.Context
+	videoId  string
+	filename string
+	cancel   context.CancelFunc
+	hash     hash.Hash
+	sent     bool // whether the message naming the file has gone out
+	err      error
+
+	owner      node
+	stream     pb.StorageService_WriteStreamClient
+	next       node
+	nextStream pb.StorageService_WriteStreamClient // nil unless writing to a joining owner too
+}
+
+func (w *nwWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), streamChunkSize)]
+		if err := w.send(&pb.WriteStreamRequest{Data: chunk}); err != nil {
+			return written, err
+		}
+		w.hash.Write(chunk)
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// send names the file in the first message and sends it to every node.
+func (w *nwWriter) send(request *pb.WriteStreamRequest) error {
+	if !w.sent {
+		request.VideoId, request.FileName = w.videoId, w.filename
+		w.sent = true
+	}
+	if w.nextStream != nil {
+		if err := w.nextStream.Send(request); err != nil {
+			return w.fail(w.nextStream, w.next)
+		}
+	}
+	if err := w.stream.Send(request); err != nil {
+		return w.fail(w.stream, w.owner)
+	}
+	return nil
+}
+
+// fail ends the write after a send on stream to n failed, with the status
+// the stream ended with.
+func (w *nwWriter) fail(stream pb.StorageService_WriteStreamClient, n node) error {
+	_, err := stream.CloseAndRecv()
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	slog.WarnContext(w.ctx, "WriteStream RPC failed", "node", n.addr, "file", path.Join(w.videoId, w.filename), "error", err)
+	w.err = writeError(err)
+	w.cancel()
+	return w.err
+}
+
+// Close sends the checksum of everything written and waits for the node to
+// store the file.
+func (w *nwWriter) Close() error {
+	defer w.cancel()
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.send(&pb.WriteStreamRequest{Sha256: w.hash.Sum(nil)}); err != nil {
+		return err
+	}
+	if _, err := w.stream.CloseAndRecv(); err != nil {
+		slog.WarnContext(w.ctx, "WriteStream RPC failed", "node", w.owner.addr, "file", path.Join(w.videoId, w.filename), "error", err)
+		w.err = writeError(err)
+		return w.err
+	}
+	if w.nextStream != nil {
+		if _, err := w.nextStream.CloseAndRecv(); err != nil {
+			slog.WarnContext(w.ctx, "WriteStream RPC to joining owner failed", "node", w.next.addr, "file", path.Join(w.videoId, w.filename), "error", err)
+			w.err = writeError(err)
+			return w.err
+		}
+	}
+	w.err = errors.New("write: file already closed")
+	return nil
+}
+
+// writeError marks a write that failed because its node is unreachable.
+func writeError(err error) error {
+	if status.Code(err) == codes.Unavailable {
+		return fmt.Errorf("%w: %v", ErrStorageUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,259 @@
+// Prefetching of the segments a viewer is about to request
+
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// manifestName is the manifest every upload is encoded with.
+const manifestName = "manifest.mpd"
+
+// parsed manifests are dropped all at once past this many videos
+const maxPrefetchManifests = 1024
+
+type prefetchJob struct {
+	videoId  string
+	filename string
+}
+
+// segmentSeries names the numbered media segments of one representation,
+// e.g. "chunk-0-" + "%05d" + ".m4s" for chunk-$RepresentationID$-$Number%05d$.m4s.
+type segmentSeries struct {
+	prefix string
+	format string
+	suffix string
+	first  int64
+	count  int64 // -1 if the manifest does not say how many there are
+}
+
+// number returns the segment number of filename if it belongs to s.
+func (s segmentSeries) number(filename string) (int64, bool) {
+	if len(filename) <= len(s.prefix)+len(s.suffix) || !strings.HasPrefix(filename, s.prefix) || !strings.HasSuffix(filename, s.suffix) {
+		return 0, false
+	}
+	digits := filename[len(s.prefix) : len(filename)-len(s.suffix)]
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	return n, err == nil
+}
+
+// segmentIndex holds the segment series of a video's manifest, and the
+// checksum of the manifest it was parsed from so it is re-parsed when that
+// changes. The cache hands out a new entry whenever the manifest comes back
+// from disk, so entries themselves cannot be compared.
+type segmentIndex struct {
+	sum    []byte
+	series []segmentSeries
+}
+
+// following returns the names of up to n segments after filename in its
+// series, stopping at the last segment the manifest lists.
+func (idx *segmentIndex) following(filename string, n int) []string {
+	for _, s := range idx.series {
+		number, ok := s.number(filename)
+		if !ok {
+			continue
+		}
+		names := make([]string, 0, n)
+		for next := number + 1; next <= number+int64(n); next++ {
+			if s.count >= 0 && next >= s.first+s.count {
+				break
+			}
+			names = append(names, s.prefix+fmt.Sprintf(s.format, next)+s.suffix)
+		}
+		return names
+	}
+	return nil
+}
+
+// mpd is the part of a DASH manifest that describes segment naming. Tags
+// match in any namespace, so the default DASH namespace needs no mention.
+type mpd struct {
+	Periods []struct {
+		AdaptationSets []struct {
+			SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+			Representations []struct {
+				Id              string              `xml:"id,attr"`
+				SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+			} `xml:"Representation"`
+		} `xml:"AdaptationSet"`
+	} `xml:"Period"`
+}
+
+type mpdSegmentTemplate struct {
+	Media       string `xml:"media,attr"`
+	StartNumber *int64 `xml:"startNumber,attr"`
+	Timeline    []struct {
+		R int64 `xml:"r,attr"`
+	} `xml:"SegmentTimeline>S"`
+}
+
+// parseManifest finds the numbered segment series of every representation
+// in a DASH manifest. Representations whose segments are named some other
+// way, such as by $Time$, are left out.
+func parseManifest(data []byte) ([]segmentSeries, error) {
+	var manifest mpd
+	if err := xml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	series := make([]segmentSeries, 0)
+	for _, period := range manifest.Periods {
+		for _, set := range period.AdaptationSets {
+			for _, rep := range set.Representations {
+				template := rep.SegmentTemplate
+				if template == nil {
+					template = set.SegmentTemplate
+				}
+				if template == nil {
+					continue
+				}
+				if s, ok := templateSeries(template, rep.Id); ok {
+					series = append(series, s)
+				}
+			}
+		}
+	}
+	return series, nil
+}
+
+// templateSeries turns a SegmentTemplate's media pattern, with the
+// representation id filled in, into a segmentSeries.
+func templateSeries(template *mpdSegmentTemplate, repId string) (segmentSeries, bool) {
+	media := strings.ReplaceAll(template.Media, "$RepresentationID$", repId)
+	start := strings.Index(media, "$Number")
+	if start < 0 {
+		return segmentSeries{}, false
+	}
+	end := strings.Index(media[start+1:], "$")
+	if end < 0 {
+		return segmentSeries{}, false
+	}
+	end += start + 1
+	s := segmentSeries{
+		prefix: media[:start],
+		format: media[start+len("$Number") : end],
+		suffix: media[end+1:],
+		first:  1,
+		count:  -1,
+	}
+	if s.format == "" {
+		s.format = "%d"
+	}
+	// other identifiers, such as $Bandwidth$, are not supported
+	if !validNumberFormat(s.format) || strings.Contains(s.prefix, "$") || strings.Contains(s.suffix, "$") || strings.Contains(s.prefix+s.suffix, "/") {
+		return segmentSeries{}, false
+	}
+	if template.StartNumber != nil {
+		s.first = *template.StartNumber
+	}
+	if len(template.Timeline) > 0 {
+		s.count = 0
+		for _, segment := range template.Timeline {
+			if segment.R < 0 {
+				// repeats until the end of the period
+				s.count = -1
+				break
+			}
+			s.count += segment.R + 1
+		}
+	}
+	return s, true
+}
+
+// validNumberFormat reports whether format is one DASH allows for $Number$:
+// plain, or zero padded to a width.
+func validNumberFormat(format string) bool {
+	if format == "%d" {
+		return true
+	}
+	width, ok := strings.CutPrefix(format, "%0")
+	if !ok {
+		return false
+	}
+	width, ok = strings.CutSuffix(width, "d")
+	_, err := strconv.Atoi(width)
+	return ok && err == nil
+}
+
+// schedulePrefetch queues the segments after filename to be fetched into the
+// cache. If every prefetch worker is busy the request is dropped, so
+// prefetching never holds up the viewer's own requests.
+func (c *CachedVideoContentService) schedulePrefetch(videoId string, filename string) {
+	if c.prefetchQueue == nil || filename == manifestName {
+		return
+	}
+	select {
+	case c.prefetchQueue <- prefetchJob{videoId: videoId, filename: filename}:
+	default:
+		c.mu.Lock()
+		c.stats.PrefetchDropped++
+		c.mu.Unlock()
+	}
+}
+
+func (c *CachedVideoContentService) prefetchWorker() {
+	ctx := context.Background()
+	for job := range c.prefetchQueue {
+		idx := c.segmentIndex(ctx, job.videoId)
+		if idx == nil {
+			continue
+		}
+		for _, name := range idx.following(job.filename, c.opts.PrefetchSegments) {
+			if c.has(path.Join(job.videoId, name)) {
+				continue
+			}
+			e, err := c.fetchShared(ctx, job.videoId, name, true)
+			if err != nil {
+				// the viewer's own request will report it
+				break
+			}
+			c.mu.Lock()
+			e.prefetched = true
+			c.stats.Prefetched++
+			c.mu.Unlock()
+		}
+	}
+}
+
+// segmentIndex returns the parsed manifest of a video, reading the manifest
+// through the cache; nil if it cannot be read or is not a DASH manifest.
+func (c *CachedVideoContentService) segmentIndex(ctx context.Context, videoId string) *segmentIndex {
+	key := path.Join(videoId, manifestName)
+	e := c.cached(key, false)
+	if e == nil {
+		var err error
+		if e, err = c.fetchShared(ctx, videoId, manifestName, true); err != nil {
+			return nil
+		}
+	}
+	c.mu.Lock()
+	idx, ok := c.manifests[videoId]
+	c.mu.Unlock()
+	if ok && bytes.Equal(idx.sum, e.info.Sha256) {
+		return idx
+	}
+	series, err := parseManifest(e.data)
+	if err != nil {
+		slog.WarnContext(ctx, "Not prefetching segments", "video", videoId, "error", err)
+	}
+	idx = &segmentIndex{sum: e.info.Sha256, series: series}
+	c.mu.Lock()
+	if len(c.manifests) >= maxPrefetchManifests {
+		c.manifests = make(map[string]*segmentIndex)
+	}
+	c.manifests[videoId] = idx
+	c.mu.Unlock()
+	return idx
+}
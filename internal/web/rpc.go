@@ -0,0 +1,96 @@
+// Deadlines, retries and connection settings for storage RPCs
+
+package web
+
+import (
+	"context"
+	"math/rand"
+	"time"
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
+	"tritontube/internal/retry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// RPCOptions tunes how the network content service talks to storage nodes.
+type RPCOptions struct {
+	ReadTimeout  time.Duration // deadline of each Read or Stat attempt, and of each chunk of an Open
+	WriteTimeout time.Duration // deadline of a Write, Create or DeleteVideo, and per file of a WriteBatch
+	Retries      int           // retries of a Read or Stat that failed transiently, on the same node
+	RetryBackoff time.Duration // wait before the first retry, doubled after each one, with jitter
+
+	KeepaliveTime       time.Duration // ping a connection after it is idle this long, 0 to disable
+	KeepaliveTimeout    time.Duration // drop the connection if a ping is not answered within this
+	MaxReconnectBackoff time.Duration // longest wait between attempts to reconnect to a node
+}
+
+var DefaultRPCOptions = RPCOptions{
+	ReadTimeout:         5 * time.Second,
+	WriteTimeout:        30 * time.Second,
+	Retries:             2,
+	RetryBackoff:        100 * time.Millisecond,
+	KeepaliveTime:       30 * time.Second,
+	KeepaliveTimeout:    10 * time.Second,
+	MaxReconnectBackoff: 2 * time.Second,
+}
+
+// dialOptions returns the options for connections to storage nodes.
+func (o RPCOptions) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// reconnect quickly so a node that comes back is used again right away
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.Config{
+			BaseDelay:  500 * time.Millisecond,
+			Multiplier: 1.6,
+			Jitter:     0.2,
+			MaxDelay:   o.MaxReconnectBackoff,
+		}}),
+	}
+	opts = append(opts, metrics.DialOptions()...)
+	opts = append(opts, logging.DialOptions()...)
+	if o.KeepaliveTime > 0 {
+		// detect a node that vanished without closing its connections
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.KeepaliveTime,
+			Timeout:             o.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts
+}
+
+// callWithRetries runs an idempotent RPC with the read deadline, retrying it
+// with jittered exponential backoff while it fails in a way another attempt
+// may fix.
+func (o RPCOptions) callWithRetries(ctx context.Context, fn func(ctx context.Context) error) error {
+	return o.retry(ctx, func() error {
+		rpcCtx, cancel := context.WithTimeout(ctx, o.ReadTimeout)
+		defer cancel()
+		return fn(rpcCtx)
+	})
+}
+
+// retry runs fn until it succeeds, fails in a way that is not retryable, or
+// has been retried o.Retries times, waiting with backoff in between.
+func (o RPCOptions) retry(ctx context.Context, fn func() error) error {
+	wait := o.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == o.Retries || !retry.Retryable(err) {
+			return err
+		}
+		// anywhere from half to one and a half times the backoff, so clients
+		// that failed together do not retry together
+		jittered := wait/2 + time.Duration(rand.Int63n(int64(wait)+1))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jittered):
+		}
+		wait *= 2
+	}
+}
@@ -3,17 +3,26 @@
 package web
 
 import (
-	"fmt"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
+)
+
+const (
+	segmentCacheControl  = "public, max-age=31536000, immutable"
+	manifestCacheControl = "public, max-age=5"
 )
 
 type server struct {
@@ -38,18 +47,28 @@ func NewServer(
 
 func (s *server) Start(lis net.Listener) error {
 	s.mux = http.NewServeMux()
-	s.mux.HandleFunc("/upload", s.handleUpload)
-	s.mux.HandleFunc("/videos/", s.handleVideo)
-	s.mux.HandleFunc("/content/", s.handleVideoContent)
-	s.mux.HandleFunc("/", s.handleIndex)
+	s.handle("/upload", "upload", s.handleUpload)
+	s.handle("/videos/", "video", s.handleVideo)
+	s.handle("/content/", "content", s.handleVideoContent)
+	if _, ok := s.contentService.(*CachedVideoContentService); ok {
+		s.handle("/debug/cache", "cache_stats", s.handleCacheStats)
+	}
+	s.mux.Handle("/metrics", metrics.Handler())
+	s.handle("/", "index", s.handleIndex)
 
 	return http.Serve(lis, s.mux)
 }
 
+// handle registers a handler whose requests get a request ID, are logged,
+// and are counted and timed under name.
+func (s *server) handle(pattern string, name string, handler http.HandlerFunc) {
+	s.mux.Handle(pattern, logging.Middleware(metrics.InstrumentHandler(name, handler)))
+}
+
 func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
-	videos, err := s.metadataService.List()
-	fmt.Println(err)
+	videos, err := s.metadataService.List(r.Context())
 	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list videos", "error", err)
 		http.Error(w, "Failed to list videos", http.StatusInternalServerError)
 		return
 	}
@@ -61,6 +80,19 @@ func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleCacheStats reports the content cache's hit rate and size as JSON.
+func (s *server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	stats := s.contentService.(*CachedVideoContentService).CacheStats()
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(struct {
+		CacheStats
+		HitRate float64 `json:"hit_rate"`
+	}{stats, stats.HitRate()})
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to write cache stats", "error", err)
+	}
+}
+
 func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -78,7 +110,7 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	videoId := strings.TrimSuffix(baseFilename, filepath.Ext(baseFilename))
 
 	// Check if the video Id is already in use
-	existingVideo, err := s.metadataService.Read(videoId)
+	existingVideo, err := s.metadataService.Read(r.Context(), videoId)
 	if err != nil {
 		http.Error(w, "Failed to check video metadata", http.StatusInternalServerError)
 		return
@@ -88,11 +120,22 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.metadataService.Create(videoId, time.Now())
+	err = s.metadataService.Create(r.Context(), videoId, time.Now())
 	if err != nil {
 		http.Error(w, "Failed to add video metadata", http.StatusInternalServerError)
 		return
 	}
+	// the metadata row reserves the video id; an upload that fails from here
+	// on gives it up again, even if the client is gone
+	uploaded := false
+	defer func() {
+		if uploaded {
+			return
+		}
+		if err := s.metadataService.Delete(context.WithoutCancel(r.Context()), videoId); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to remove metadata of failed upload", "video", videoId, "error", err)
+		}
+	}()
 
 	videoData, err := io.ReadAll(file)
 	if err != nil {
@@ -119,8 +162,8 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	// path to the manifest file
 	manifestPath := filepath.ToSlash(filepath.Join(tempDir, "manifest.mpd"))
 
-	// ffmpeg command to create MPEG-DASH files
-	cmd := exec.Command("ffmpeg",
+	// ffmpeg command to create MPEG-DASH files, killed if the client goes away
+	cmd := exec.CommandContext(r.Context(), "ffmpeg",
 		"-i", videoPath, // input file
 		"-c:v", "libx264", // video codec
 		"-c:a", "aac", // audio codec
@@ -142,7 +185,10 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	cmd.Stderr = os.Stderr
 
 	// run the ffmpeg command
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err = cmd.Run()
+	metrics.ObserveTranscode(time.Since(start), err)
+	if err != nil {
 		http.Error(w, "Failed to encode video: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -161,6 +207,7 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	videoFiles := make([]VideoFile, 0, len(files))
 	for _, file := range files {
 		if file.IsDir() {
 			continue
@@ -172,21 +219,34 @@ func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Failed to read file: "+file.Name(), http.StatusInternalServerError)
 			return
 		}
+		videoFiles = append(videoFiles, VideoFile{Name: file.Name(), Data: data})
+	}
 
-		err = s.contentService.Write(videoId, file.Name(), data)
-		if err != nil {
-			log.Println("Failed to write file to content service:", err)
-			http.Error(w, "Failed to write file to content service: "+file.Name(), http.StatusInternalServerError)
-			return
+	err = s.contentService.WriteBatch(r.Context(), videoId, videoFiles)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write files to content service", "video", videoId, "error", err)
+		// don't leave a partial video behind, even if the client is gone
+		if deleteErr := s.contentService.DeleteVideo(context.WithoutCancel(r.Context()), videoId); deleteErr != nil {
+			slog.ErrorContext(r.Context(), "Failed to clean up partial upload", "video", videoId, "error", deleteErr)
 		}
 	}
+	if errors.Is(err, ErrStorageUnavailable) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Storage node unavailable, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to write files to content service", http.StatusInternalServerError)
+		return
+	}
 
+	uploaded = true
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (s *server) handleVideo(w http.ResponseWriter, r *http.Request) {
 	videoId := r.URL.Path[len("/videos/"):]
-	video, err := s.metadataService.Read(videoId)
+	video, err := s.metadataService.Read(r.Context(), videoId)
 
 	if err != nil {
 		http.Error(w, "Failed to get video metadata", http.StatusInternalServerError)
@@ -214,17 +274,6 @@ func (s *server) handleVideoContent(w http.ResponseWriter, r *http.Request) {
 	}
 	videoId = parts[0]
 	filename := parts[1]
-	// fmt.Println("Trying to read")
-	data, err := s.contentService.Read(videoId, filename)
-	if err != nil {
-		// fmt.Println("Error here")
-		http.Error(w, "Failed to get video content", http.StatusInternalServerError)
-		return
-	}
-	if data == nil {
-		http.NotFound(w, r)
-		return
-	}
 
 	// Serve the file with proper headers.
 	if strings.HasSuffix(filename, ".mpd") {
@@ -233,10 +282,82 @@ func (s *server) handleVideoContent(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "video/mp4")
 	}
 
-	// Serve full file.
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(data); err != nil {
-		log.Printf("Failed to write .mp4 response: %v", err)
+	// answer HEAD from the file's metadata instead of downloading it
+	if r.Method == http.MethodHead {
+		info, err := s.contentService.Stat(r.Context(), videoId, filename)
+		if r.Context().Err() != nil {
+			// the client went away
+			return
+		}
+		if errors.Is(err, ErrStorageUnavailable) {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to stat file", "video", videoId, "file", filename, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		setCachingHeaders(w, filename, info)
+		if w.Header().Get("Content-Type") == "" {
+			// keep ServeContent from reading the stand-in content to sniff it
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		// ServeContent only seeks in the content of a HEAD request, to find
+		// its size
+		http.ServeContent(w, r, filename, info.ModTime, io.NewSectionReader(strings.NewReader(""), 0, info.Size))
+		return
+	}
+
+	// stream the file rather than reading it whole; ServeContent also
+	// answers range and conditional requests
+	file, info, err := s.contentService.Open(r.Context(), videoId, filename)
+	if r.Context().Err() != nil {
+		// the client went away, so there is no one to answer
+		if file != nil {
+			file.Close()
+		}
+		return
+	}
+	if errors.Is(err, ErrStorageUnavailable) {
+		slog.WarnContext(r.Context(), "Failed to read file", "video", videoId, "file", filename, "error", err)
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Storage node unavailable, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to open file", "video", videoId, "file", filename, "error", err)
+		http.Error(w, "Failed to get video content", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	setCachingHeaders(w, filename, info)
+	http.ServeContent(w, r, filename, info.ModTime, file)
+}
+
+// setCachingHeaders sets a strong ETag from the file's checksum, which
+// ServeContent checks If-None-Match against, and how long browsers and
+// CDNs may cache the file.
+func setCachingHeaders(w http.ResponseWriter, filename string, info *FileInfo) {
+	if len(info.Sha256) > 0 {
+		w.Header().Set("ETag", `"`+hex.EncodeToString(info.Sha256)+`"`)
+	}
+	switch {
+	case strings.HasSuffix(filename, ".m4s"):
+		// segments never change once written
+		w.Header().Set("Cache-Control", segmentCacheControl)
+	case strings.HasSuffix(filename, ".mpd"):
+		w.Header().Set("Cache-Control", manifestCacheControl)
+	default:
+		w.Header().Set("Cache-Control", "no-cache")
 	}
 }
@@ -3,6 +3,7 @@
 package web
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -46,9 +47,9 @@ func NewSQLiteVideoMetadataService(dbPath string) (*SQLiteVideoMetadataService,
 	return &SQLiteVideoMetadataService{db: db}, nil
 }
 
-func (s *SQLiteVideoMetadataService) Read(id string) (*VideoMetadata, error) {
+func (s *SQLiteVideoMetadataService) Read(ctx context.Context, id string) (*VideoMetadata, error) {
 	query := "SELECT id, uploaded_at FROM videos WHERE id = ?"
-	row := s.db.QueryRow(query, id)
+	row := s.db.QueryRowContext(ctx, query, id)
 
 	video := &VideoMetadata{}
 	var uploadedAtStr string
@@ -69,9 +70,9 @@ func (s *SQLiteVideoMetadataService) Read(id string) (*VideoMetadata, error) {
 	return video, nil
 }
 
-func (s *SQLiteVideoMetadataService) List() ([]VideoMetadata, error) {
+func (s *SQLiteVideoMetadataService) List(ctx context.Context) ([]VideoMetadata, error) {
 	query := "SELECT id, uploaded_at FROM videos ORDER BY uploaded_at DESC"
-	rows, err := s.db.Query(query)
+	rows, err := s.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query videos: %w", err)
 	}
@@ -102,13 +103,21 @@ func (s *SQLiteVideoMetadataService) List() ([]VideoMetadata, error) {
 	return videos, nil
 }
 
-func (s *SQLiteVideoMetadataService) Create(videoId string, uploadedAt time.Time) error {
+func (s *SQLiteVideoMetadataService) Create(ctx context.Context, videoId string, uploadedAt time.Time) error {
 	query := "INSERT INTO videos (id, uploaded_at) VALUES (?, ?)"
 	uploadedAtStr := uploadedAt.Format(time.RFC3339)
 
-	_, err := s.db.Exec(query, videoId, uploadedAtStr)
+	_, err := s.db.ExecContext(ctx, query, videoId, uploadedAtStr)
 	if err != nil {
 		return fmt.Errorf("failed to insert video: %w", err)
 	}
 	return nil
 }
+
+func (s *SQLiteVideoMetadataService) Delete(ctx context.Context, videoId string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM videos WHERE id = ?", videoId)
+	if err != nil {
+		return fmt.Errorf("failed to delete video: %w", err)
+	}
+	return nil
+}